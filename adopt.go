@@ -0,0 +1,220 @@
+package mig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// historyTables are the default history tables of the migration tools whose
+// history can be adopted.
+var historyTables = map[Dialect]string{
+	DialectGolangMigrate: "schema_migrations",
+	DialectGoose:         "goose_db_version",
+	DialectFlyway:        "flyway_schema_history",
+	DialectTern:          "public.schema_version",
+}
+
+// adoptedHistory holds the versions applied according to the history table
+// of another tool. Versions are applied explicitly, while every migration up
+// to through is applied implicitly, as by a Flyway baseline.
+type adoptedHistory struct {
+	versions []uint64
+	through  uint64
+}
+
+// Adopt records the migrations applied according to the history table of
+// dialect, read from table, as applied in the migrations table.
+func (db *pgxDB) Adopt(ctx context.Context, ms Migrations, dialect Dialect, table string) error {
+	return db.locked(ctx, func(tx pgx.Tx) error {
+		h, err := readHistory(ctx, tx, dialect, sanitizeTableName(table))
+		if err != nil {
+			return fmt.Errorf("read %s history: %w", dialect, err)
+		}
+
+		var adopted Migrations
+
+		for _, v := range h.versions {
+			i := slices.IndexFunc(ms, func(m Migration) bool { return m.Version == v })
+			if i < 0 {
+				return fmt.Errorf("%w: %s version %d", ErrMissingMigration, dialect, v)
+			}
+
+			adopted = append(adopted, ms[i])
+		}
+
+		for _, m := range ms {
+			if m.Version <= h.through && !slices.Contains(h.versions, m.Version) {
+				adopted = append(adopted, m)
+			}
+		}
+
+		for _, m := range adopted {
+			if err := db.setAdopted(ctx, tx, m); err != nil {
+				return fmt.Errorf("set adopted version %d: %w", m.Version, err)
+			}
+		}
+
+		db.logger.InfoContext(ctx, "migrations adopted", slog.String("dialect", dialect.String()),
+			slog.String("history_table", table), slog.Int("count", len(adopted)))
+
+		return nil
+	})
+}
+
+// setAdopted records m as applied, filling in the columns left empty when
+// the migrations table is the golang-migrate history table itself.
+func (db *pgxDB) setAdopted(ctx context.Context, exec pgxExecutor, m Migration) error {
+	q := fmt.Sprintf(`INSERT INTO %s AS t (version, name, path, applied_at, applied_by, checksum)
+VALUES ($1, $2, $3, clock_timestamp(), %s, $5)
+ON CONFLICT (version) DO UPDATE SET name = coalesce(t.name, excluded.name),
+	path = coalesce(t.path, excluded.path), applied_at = coalesce(t.applied_at, excluded.applied_at),
+	applied_by = coalesce(t.applied_by, excluded.applied_by), checksum = coalesce(t.checksum, excluded.checksum)`,
+		db.table, appliedBy(4))
+
+	if _, err := exec.Exec(ctx, q, m.Version, m.Name, m.Path, db.appIdentity, m.Checksum()); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+
+	return nil
+}
+
+func readHistory(ctx context.Context, exec pgxExecutor, dialect Dialect, table string) (adoptedHistory, error) {
+	switch dialect {
+	case DialectGolangMigrate:
+		return readGolangMigrateHistory(ctx, exec, table)
+	case DialectGoose:
+		return readGooseHistory(ctx, exec, table)
+	case DialectFlyway:
+		return readFlywayHistory(ctx, exec, table)
+	case DialectTern:
+		return readTernHistory(ctx, exec, table)
+	default:
+		return adoptedHistory{}, errors.ErrUnsupported //nolint:exhaustruct
+	}
+}
+
+// readGolangMigrateHistory reads the single row golang-migrate keeps with
+// the last applied version.
+func readGolangMigrateHistory(ctx context.Context, exec pgxExecutor, table string) (adoptedHistory, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+
+	err := exec.QueryRow(ctx, "SELECT version, dirty FROM "+table+" ORDER BY version DESC LIMIT 1").
+		Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return adoptedHistory{}, nil //nolint:exhaustruct
+	}
+
+	if err != nil {
+		return adoptedHistory{}, fmt.Errorf("query row: %w", err) //nolint:exhaustruct
+	}
+
+	if dirty {
+		return adoptedHistory{}, fmt.Errorf("%w: %d", ErrDirty, version) //nolint:exhaustruct
+	}
+
+	if version <= 0 {
+		return adoptedHistory{}, nil //nolint:exhaustruct
+	}
+
+	return adoptedHistory{versions: []uint64{uint64(version)}, through: uint64(version)}, nil
+}
+
+// readGooseHistory reads the versions whose latest goose history row marks
+// them as applied. Goose records version 0 when it creates its table.
+func readGooseHistory(ctx context.Context, exec pgxExecutor, table string) (adoptedHistory, error) {
+	rows, err := exec.Query(ctx, `SELECT DISTINCT ON (version_id) version_id, is_applied FROM `+table+`
+		ORDER BY version_id, id DESC`)
+	if err != nil {
+		return adoptedHistory{}, fmt.Errorf("query: %w", err) //nolint:exhaustruct
+	}
+
+	var h adoptedHistory
+
+	var (
+		version int64
+		applied bool
+	)
+
+	if _, err := pgx.ForEachRow(rows, []any{&version, &applied}, func() error {
+		if applied && version > 0 {
+			h.versions = append(h.versions, uint64(version))
+		}
+
+		return nil
+	}); err != nil {
+		return adoptedHistory{}, fmt.Errorf("collect rows: %w", err) //nolint:exhaustruct
+	}
+
+	return h, nil
+}
+
+// readFlywayHistory reads the versions whose latest Flyway history row
+// applied them. A baseline row applies every version up to its own.
+func readFlywayHistory(ctx context.Context, exec pgxExecutor, table string) (adoptedHistory, error) {
+	rows, err := exec.Query(ctx, `SELECT DISTINCT ON (version) version, type, success FROM `+table+`
+		WHERE version IS NOT NULL ORDER BY version, installed_rank DESC`)
+	if err != nil {
+		return adoptedHistory{}, fmt.Errorf("query: %w", err) //nolint:exhaustruct
+	}
+
+	var h adoptedHistory
+
+	var (
+		id, kind string
+		success  bool
+	)
+
+	if _, err := pgx.ForEachRow(rows, []any{&id, &kind, &success}, func() error {
+		version, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || version > maxPostgresBigintVersion {
+			return fmt.Errorf("%w: %s", ErrInvalidVersion, id)
+		}
+
+		switch {
+		case version == 0:
+		case !success:
+			return fmt.Errorf("%w: %d", ErrDirty, version)
+		case kind == "BASELINE":
+			h.through = max(h.through, version)
+		case kind == "UNDO_SQL", kind == "UNDO_JDBC", kind == "UNDO_SCRIPT", kind == "DELETE":
+		default:
+			h.versions = append(h.versions, version)
+		}
+
+		return nil
+	}); err != nil {
+		return adoptedHistory{}, fmt.Errorf("collect rows: %w", err) //nolint:exhaustruct
+	}
+
+	return h, nil
+}
+
+// readTernHistory reads the single row tern keeps with the last applied
+// version.
+func readTernHistory(ctx context.Context, exec pgxExecutor, table string) (adoptedHistory, error) {
+	var version int64
+
+	err := exec.QueryRow(ctx, "SELECT version FROM "+table+" ORDER BY version DESC LIMIT 1").Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return adoptedHistory{}, nil //nolint:exhaustruct
+	}
+
+	if err != nil {
+		return adoptedHistory{}, fmt.Errorf("query row: %w", err) //nolint:exhaustruct
+	}
+
+	if version <= 0 {
+		return adoptedHistory{}, nil //nolint:exhaustruct
+	}
+
+	return adoptedHistory{versions: []uint64{uint64(version)}, through: uint64(version)}, nil
+}
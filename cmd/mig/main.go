@@ -0,0 +1,309 @@
+// Command mig applies PostgreSQL schema migrations from a directory.
+//
+// Usage:
+//
+//	mig [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	up             apply all pending migrations
+//	down [steps]   revert the last steps applied migrations (default 1)
+//	status         list applied and pending migrations
+//	force <version>
+//	               record version as cleanly applied after a manual fix
+//	create <name>  create a new migration file, versioned with the UTC time
+//	               when the -timestamp flag is set
+//	validate       check that the migrations directory can be loaded
+//	version        print the version of mig
+//
+// Exit codes are 0 on success, 1 when a command fails, 2 on invalid usage and
+// 3 when the migrations are invalid or do not match the applied ones.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"go.acim.net/mig"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	exitInvalid = 3
+)
+
+var errUsage = errors.New("invalid usage")
+
+type config struct {
+	dsn             string
+	table           string
+	dir             string
+	allowOutOfOrder bool
+	quiet           bool
+	timestamp       bool
+	stdout          io.Writer
+	stderr          io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	cfg := config{stdout: stdout, stderr: stderr} //nolint:exhaustruct
+
+	flags := flag.NewFlagSet("mig", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&cfg.dsn, "dsn", os.Getenv("DATABASE_URL"), "PostgreSQL connection string (default $DATABASE_URL)")
+	flags.StringVar(&cfg.table, "table", "", "migrations table name (default schema_migrations)")
+	flags.StringVar(&cfg.dir, "dir", "migrations", "migrations directory")
+	flags.BoolVar(&cfg.allowOutOfOrder, "allow-out-of-order", false,
+		"apply pending migrations with versions lower than the last applied one")
+	flags.BoolVar(&cfg.quiet, "quiet", false, "do not log migration progress")
+	flags.BoolVar(&cfg.timestamp, "timestamp", false,
+		"version new migrations with the UTC time instead of the next number")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr,
+			"Usage: mig [flags] up|down [steps]|status|force <version>|create <name>|validate|version")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+
+		return exitUsage
+	}
+
+	err := command(ctx, cfg, flags.Arg(0), flags.Args()[1:])
+	if err == nil {
+		return exitOK
+	}
+
+	fmt.Fprintf(stderr, "mig: %v\n", err)
+
+	switch {
+	case errors.Is(err, errUsage):
+		flags.Usage()
+
+		return exitUsage
+	case errors.Is(err, mig.ErrInvalidVersion),
+		errors.Is(err, mig.ErrDuplicateVersion),
+		errors.Is(err, mig.ErrMissingUp),
+		errors.Is(err, mig.ErrInvalidTableName),
+		errors.Is(err, mig.ErrChecksumMismatch),
+		errors.Is(err, mig.ErrDirty),
+		errors.Is(err, mig.ErrOutOfOrder):
+		return exitInvalid
+	default:
+		return exitFailure
+	}
+}
+
+func command(ctx context.Context, cfg config, name string, args []string) error {
+	switch name {
+	case "up":
+		if len(args) != 0 {
+			return fmt.Errorf("%w: up takes no arguments", errUsage)
+		}
+
+		return withMigrator(ctx, cfg, func(m *mig.Mig) error {
+			return m.Migrate(ctx)
+		})
+	case "down":
+		steps, err := downSteps(args)
+		if err != nil {
+			return err
+		}
+
+		return withMigrator(ctx, cfg, func(m *mig.Mig) error {
+			return m.Rollback(ctx, steps)
+		})
+	case "status":
+		if len(args) != 0 {
+			return fmt.Errorf("%w: status takes no arguments", errUsage)
+		}
+
+		return withMigrator(ctx, cfg, func(m *mig.Mig) error {
+			return status(ctx, cfg.stdout, m)
+		})
+	case "force":
+		if len(args) != 1 {
+			return fmt.Errorf("%w: force takes a version", errUsage)
+		}
+
+		version, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid version %q", errUsage, args[0])
+		}
+
+		return withMigrator(ctx, cfg, func(m *mig.Mig) error {
+			return m.Force(ctx, version)
+		})
+	case "create":
+		if len(args) != 1 {
+			return fmt.Errorf("%w: create takes a migration name", errUsage)
+		}
+
+		return create(cfg, args[0])
+	case "validate":
+		return validate(cfg)
+	case "version":
+		fmt.Fprintln(cfg.stdout, version())
+
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, name)
+	}
+}
+
+func downSteps(args []string) (int, error) {
+	switch len(args) {
+	case 0:
+		return 1, nil
+	case 1:
+		steps, err := strconv.Atoi(args[0])
+		if err != nil || steps <= 0 {
+			return 0, fmt.Errorf("%w: invalid number of steps %q", errUsage, args[0])
+		}
+
+		return steps, nil
+	default:
+		return 0, fmt.Errorf("%w: down takes at most one argument", errUsage)
+	}
+}
+
+func withMigrator(ctx context.Context, cfg config, fn func(m *mig.Mig) error) (err error) {
+	if cfg.dsn == "" {
+		return fmt.Errorf("%w: missing -dsn flag or DATABASE_URL", errUsage)
+	}
+
+	ms, err := mig.FromDir(cfg.dir)
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+
+	conn, err := pgx.Connect(ctx, cfg.dsn)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+
+	defer func() {
+		if closeErr := conn.Close(context.WithoutCancel(ctx)); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("close connection: %w", closeErr))
+		}
+	}()
+
+	var opts []mig.Option
+	if !cfg.quiet {
+		opts = append(opts, mig.WithLogger(slog.New(slog.NewTextHandler(cfg.stderr, nil))))
+	}
+
+	if cfg.table != "" {
+		opts = append(opts, mig.WithCustomTable(cfg.table))
+	}
+
+	if cfg.allowOutOfOrder {
+		opts = append(opts, mig.WithAllowOutOfOrder())
+	}
+
+	return fn(mig.FromPgx(ms, conn, opts...))
+}
+
+func status(ctx context.Context, w io.Writer, m *mig.Mig) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:mnd
+
+	fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED AT\tPATH")
+
+	for _, s := range statuses {
+		appliedAt := "-"
+		if s.Applied != nil && !s.Applied.AppliedAt.IsZero() {
+			appliedAt = s.Applied.AppliedAt.UTC().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, s.State, appliedAt, s.Path)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("write status: %w", err)
+	}
+
+	return nil
+}
+
+func validate(cfg config) error {
+	ms, err := mig.FromDir(cfg.dir)
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+
+	if err := ms.Validate(); err != nil {
+		return fmt.Errorf("validate migrations: %w", err)
+	}
+
+	fmt.Fprintf(cfg.stdout, "%d migrations are valid\n", len(ms))
+
+	return nil
+}
+
+// create writes an empty migration file versioned with the next number or,
+// with the timestamp flag, the current UTC time.
+func create(cfg config, name string) error {
+	scheme := mig.SequentialVersion
+	if cfg.timestamp {
+		scheme = mig.TimestampVersion
+	}
+
+	path, err := mig.NewMigrationFile(cfg.dir, name, scheme)
+	if errors.Is(err, mig.ErrInvalidName) {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cfg.stdout, path)
+
+	return nil
+}
+
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+
+	return info.Main.Version
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+func TestRunReturnsUsageExitCode(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"-unknown-flag", "up"},
+		{"down", "zero"},
+		{"down", "1", "2"},
+		{"create"},
+		{"force"},
+		{"force", "-1"},
+		{"-dsn", "", "up"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr bytes.Buffer
+
+			if code := run(context.Background(), args, &stdout, &stderr); code != exitUsage {
+				t.Fatalf("run(%q)=%d; want %d; stderr=%s", args, code, exitUsage, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "001-one.sql"), "SELECT 1")
+
+	var stdout, stderr bytes.Buffer
+
+	if code := run(context.Background(), []string{"-dir", dir, "validate"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run(validate)=%d; want %d; stderr=%s", code, exitOK, stderr.String())
+	}
+
+	if got := stdout.String(); got != "1 migrations are valid\n" {
+		t.Fatalf("validate output=%q; want migrations count", got)
+	}
+}
+
+func TestRunValidateReturnsInvalidExitCode(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "broken.sql"), "SELECT 1")
+
+	var stdout, stderr bytes.Buffer
+
+	if code := run(context.Background(), []string{"-dir", dir, "validate"}, &stdout, &stderr); code != exitInvalid {
+		t.Fatalf("run(validate)=%d; want %d", code, exitInvalid)
+	}
+
+	if !strings.Contains(stderr.String(), "invalid migration version prefix") {
+		t.Fatalf("validate stderr=%q; want invalid version error", stderr.String())
+	}
+}
+
+func TestRunCreateKeepsZeroPadding(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "001-one.sql"), "SELECT 1")
+	writeFile(t, filepath.Join(dir, "002-two.sql"), "SELECT 2")
+
+	var stdout, stderr bytes.Buffer
+
+	if code := run(context.Background(), []string{"-dir", dir, "create", "add-users"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run(create)=%d; want %d; stderr=%s", code, exitOK, stderr.String())
+	}
+
+	want := filepath.Join(dir, "003-add-users.sql")
+	if got := strings.TrimSpace(stdout.String()); got != want {
+		t.Fatalf("create output=%q; want %q", got, want)
+	}
+
+	if _, err := os.Stat(want); err != nil {
+		t.Fatalf("stat created migration: %v", err)
+	}
+}
+
+func TestRunCreateInEmptyDirectory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	var stdout, stderr bytes.Buffer
+
+	if code := run(context.Background(), []string{"-dir", dir, "create", "initial"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run(create)=%d; want %d; stderr=%s", code, exitOK, stderr.String())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "1-initial.sql")); err != nil {
+		t.Fatalf("stat created migration: %v", err)
+	}
+}
+
+func TestRunUpReturnsFailureExitCodeForUnreachableDatabase(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "001-one.sql"), "SELECT 1")
+
+	var stdout, stderr bytes.Buffer
+
+	code := run(context.Background(), []string{"-dsn", "postgres://postgres@127.0.0.1:1/mig", "-dir", dir, "up"},
+		&stdout, &stderr)
+	if code != exitFailure {
+		t.Fatalf("run(up)=%d; want %d", code, exitFailure)
+	}
+
+	if !strings.Contains(stderr.String(), "connect") {
+		t.Fatalf("up stderr=%q; want connect error", stderr.String())
+	}
+}
+
+func TestRunUpAndStatus(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	dir := t.TempDir()
+	table := fmt.Sprintf("cmd_versions_%d", time.Now().UnixNano())
+	writeFile(t, filepath.Join(dir, "001-one.sql"), "SELECT 1")
+
+	t.Cleanup(func() {
+		conn, err := pgx.Connect(context.Background(), testDSN())
+		if err != nil {
+			t.Errorf("connect: %v", err)
+
+			return
+		}
+		defer func() {
+			if err := conn.Close(context.Background()); err != nil {
+				t.Errorf("close connection: %v", err)
+			}
+		}()
+
+		if _, err := conn.Exec(context.Background(), "DROP TABLE IF EXISTS "+table); err != nil {
+			t.Errorf("drop table %s: %v", table, err)
+		}
+	})
+
+	for _, command := range []string{"up", "status"} {
+		var stdout, stderr bytes.Buffer
+
+		code := run(context.Background(), []string{"-dsn", testDSN(), "-table", table, "-dir", dir, command},
+			&stdout, &stderr)
+		if code != exitOK {
+			t.Fatalf("run(%s)=%d; want %d; stderr=%s", command, code, exitOK, stderr.String())
+		}
+
+		if command == "status" && !strings.Contains(stdout.String(), "applied") {
+			t.Fatalf("status output=%q; want applied migration", stdout.String())
+		}
+	}
+}
+
+func TestRunVersion(t *testing.T) {
+	t.Parallel()
+
+	var stdout, stderr bytes.Buffer
+
+	if code := run(context.Background(), []string{"version"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run(version)=%d; want %d", code, exitOK)
+	}
+
+	if strings.TrimSpace(stdout.String()) == "" {
+		t.Fatal("version output is empty")
+	}
+}
+
+func testDSN() string {
+	if dsn := os.Getenv("MIG_TEST_DSN"); dsn != "" {
+		return dsn
+	}
+
+	return "postgres://postgres@localhost:5432/mig"
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestRunCreateWithTimestamp(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	var stdout, stderr bytes.Buffer
+
+	if code := run(context.Background(), []string{"-dir", dir, "-timestamp", "create", "initial"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run(create)=%d; want %d; stderr=%s", code, exitOK, stderr.String())
+	}
+
+	name := filepath.Base(strings.TrimSpace(stdout.String()))
+	if len(name) != len("20060102150405-initial.sql") || !strings.HasSuffix(name, "-initial.sql") {
+		t.Fatalf("created migration=%q; want timestamp version", name)
+	}
+}
+
+func TestRunCreateRejectsInvalidName(t *testing.T) {
+	t.Parallel()
+
+	var stdout, stderr bytes.Buffer
+
+	if code := run(context.Background(), []string{"-dir", t.TempDir(), "create", "a/b"}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("run(create)=%d; want %d", code, exitUsage)
+	}
+}
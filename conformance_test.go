@@ -0,0 +1,78 @@
+package mig_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.acim.net/mig"
+	"go.acim.net/mig/migtest"
+)
+
+func TestPgxDatabaseConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, mig.TestDSN())
+	if err != nil {
+		t.Fatalf("create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	migtest.RunDatabaseConformance(t, func(t *testing.T, table string) mig.Database {
+		t.Helper()
+
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatalf("acquire connection: %v", err)
+		}
+
+		t.Cleanup(func() {
+			defer conn.Release()
+
+			if _, err := conn.Exec(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Errorf("drop table %s: %v", table, err)
+			}
+		})
+
+		return mig.NewPgxPoolDatabase(conn, table)
+	})
+}
+
+func TestSQLDatabaseConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+
+	db, err := sql.Open("pgx", mig.TestDSN())
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	migtest.RunDatabaseConformance(t, func(t *testing.T, table string) mig.Database {
+		t.Helper()
+
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("acquire connection: %v", err)
+		}
+
+		t.Cleanup(func() {
+			defer conn.Close() //nolint:errcheck
+
+			if _, err := conn.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Errorf("drop table %s: %v", table, err)
+			}
+		})
+
+		return mig.NewSQLDatabase(conn, table)
+	})
+}
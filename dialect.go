@@ -0,0 +1,201 @@
+package mig
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Dialect selects the file layout of the migrations to load and the history
+// table to adopt, for migrations written for other tools.
+type Dialect int
+
+const (
+	// DialectMig loads files like "001-name.sql" or "001-name.up.sql" with
+	// an optional "-- +mig Down" section. It is the default.
+	DialectMig Dialect = iota
+
+	// DialectGolangMigrate loads golang-migrate files like
+	// "1_name.up.sql" and "1_name.down.sql".
+	DialectGolangMigrate
+
+	// DialectGoose loads goose files like "00001_name.sql" with
+	// "-- +goose Up" and "-- +goose Down" sections. The
+	// "-- +goose NO TRANSACTION" annotation sets NoTransaction.
+	DialectGoose
+
+	// DialectFlyway loads Flyway versioned files like "V1__name.sql" and
+	// undo files like "U1__name.sql". Repeatable migrations, like
+	// "R__name.sql", have no version.
+	DialectFlyway
+
+	// DialectTern loads tern files like "001_name.sql", with the down SQL
+	// below a "---- create above / drop below ----" line.
+	DialectTern
+)
+
+const (
+	gooseAnnotationPrefix = "-- +goose"
+	ternDownSectionMarker = "---- create above / drop below ----"
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectMig:
+		return "mig"
+	case DialectGolangMigrate:
+		return "golang-migrate"
+	case DialectGoose:
+		return "goose"
+	case DialectFlyway:
+		return "flyway"
+	case DialectTern:
+		return "tern"
+	default:
+		return fmt.Sprintf("Dialect(%d)", int(d))
+	}
+}
+
+// sqlSections holds the parts of a migration file.
+type sqlSections struct {
+	up            string
+	down          string
+	hasDown       bool
+	noTransaction bool
+}
+
+// parseFileName returns the version prefix and the name of the migration in
+// fileName, and whether the file holds down SQL. The version prefix is empty
+// for files without a version.
+func (d Dialect) parseFileName(fileName string) (string, string, bool) {
+	ext := path.Ext(fileName)
+
+	if d == DialectFlyway {
+		var down bool
+
+		switch {
+		case strings.HasPrefix(fileName, "V"):
+		case strings.HasPrefix(fileName, "U"):
+			down = true
+		default:
+			return "", "", false
+		}
+
+		id, name, ok := strings.Cut(fileName[1:], "__")
+		if !ok {
+			return "", "", false
+		}
+
+		return id, strings.TrimSuffix(name, ext), down
+	}
+
+	id := numberPrefix(fileName)
+
+	name := strings.TrimPrefix(fileName, id)
+	name = strings.TrimPrefix(name, "-")
+	name = strings.TrimPrefix(name, "_")
+	name = strings.TrimSuffix(name, ext)
+
+	down := strings.HasSuffix(name, downSuffix)
+	name = strings.TrimSuffix(name, downSuffix)
+	name = strings.TrimSuffix(name, upSuffix)
+
+	return id, name, down
+}
+
+// newFile returns the name and the content of a new migration file with
+// version zero padded to width.
+func (d Dialect) newFile(width int, version uint64, name, ext string) (string, string) {
+	switch d {
+	case DialectGolangMigrate:
+		return fmt.Sprintf("%0*d_%s%s%s", width, version, name, upSuffix, ext), ""
+	case DialectGoose:
+		return fmt.Sprintf("%0*d_%s%s", width, version, name, ext),
+			gooseAnnotationPrefix + " Up\n\n" + gooseAnnotationPrefix + " Down\n"
+	case DialectFlyway:
+		return fmt.Sprintf("V%0*d__%s%s", width, version, name, ext), ""
+	case DialectTern:
+		return fmt.Sprintf("%0*d_%s%s", width, version, name, ext), ""
+	default:
+		return fmt.Sprintf("%0*d-%s%s", width, version, name, ext), ""
+	}
+}
+
+// split returns the sections of the migration file content sql.
+func (d Dialect) split(sql string) (sqlSections, error) {
+	switch d {
+	case DialectMig:
+		return splitSection(sql, downSectionMarker), nil
+	case DialectTern:
+		return splitSection(sql, ternDownSectionMarker), nil
+	case DialectGoose:
+		return splitGooseSections(sql)
+	case DialectGolangMigrate, DialectFlyway:
+		return sqlSections{up: sql}, nil //nolint:exhaustruct
+	default:
+		return sqlSections{}, fmt.Errorf("unknown dialect %s", d) //nolint:exhaustruct
+	}
+}
+
+// splitSection splits SQL on the first line consisting of marker, returning
+// the up and down parts.
+func splitSection(sql, marker string) sqlSections {
+	offset := 0
+
+	for line := range strings.SplitAfterSeq(sql, "\n") {
+		if strings.TrimSpace(line) == marker {
+			return sqlSections{up: sql[:offset], down: sql[offset+len(line):], hasDown: true} //nolint:exhaustruct
+		}
+
+		offset += len(line)
+	}
+
+	return sqlSections{up: sql} //nolint:exhaustruct
+}
+
+// splitGooseSections splits SQL on the "-- +goose Up" and "-- +goose Down"
+// annotations. Statement annotations are dropped, as migrations are executed
+// as a whole.
+func splitGooseSections(sql string) (sqlSections, error) {
+	var (
+		s       sqlSections
+		up      strings.Builder
+		down    strings.Builder
+		current *strings.Builder
+		hasUp   bool
+	)
+
+	for line := range strings.Lines(sql) {
+		annotation, ok := strings.CutPrefix(strings.TrimSpace(line), gooseAnnotationPrefix)
+		if !ok {
+			if current != nil {
+				current.WriteString(line)
+			}
+
+			continue
+		}
+
+		switch annotation = strings.TrimSpace(annotation); strings.ToLower(annotation) {
+		case "up":
+			current = &up
+			hasUp = true
+		case "down":
+			current = &down
+			s.hasDown = true
+		case "no transaction":
+			s.noTransaction = true
+		case "statementbegin", "statementend":
+		default:
+			return s, fmt.Errorf("%w: %s %s", ErrInvalidDirective, gooseAnnotationPrefix, annotation)
+		}
+	}
+
+	if !hasUp {
+		return s, fmt.Errorf("%w: missing %s Up", ErrInvalidDirective, gooseAnnotationPrefix)
+	}
+
+	s.up = up.String()
+	s.down = down.String()
+
+	return s, nil
+}
@@ -0,0 +1,141 @@
+package mig_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"go.acim.net/mig"
+)
+
+func TestFromFSWithDialectGolangMigrate(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"1_users.up.sql":   {Data: []byte("CREATE TABLE users ()")},
+		"1_users.down.sql": {Data: []byte("DROP TABLE users")},
+		"2_posts.up.sql":   {Data: []byte("CREATE TABLE posts ()\n-- +mig Down\nnot a section")},
+	}
+
+	got, err := mig.FromFS(fsys, ".", mig.WithDialect(mig.DialectGolangMigrate))
+	if err != nil {
+		t.Fatalf("FromFS(): %v", err)
+	}
+
+	if len(got) != 2 || got[0].Name != "users" || got[0].DownSQL != "DROP TABLE users" {
+		t.Fatalf("FromFS()=%#v; want users with down SQL and posts", got)
+	}
+
+	if got[1].DownSQL != "" {
+		t.Fatalf("posts down SQL=%q; want none", got[1].DownSQL)
+	}
+}
+
+func TestFromFSWithDialectGoose(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"00001_users.sql": {Data: []byte(`-- users table
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE users ();
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE users;
+`)},
+		"00002_users_name_idx.sql": {Data: []byte(`-- +goose NO TRANSACTION
+-- +goose Up
+CREATE INDEX CONCURRENTLY users_name_idx ON users (name);
+`)},
+	}
+
+	got, err := mig.FromFS(fsys, ".", mig.WithDialect(mig.DialectGoose))
+	if err != nil {
+		t.Fatalf("FromFS(): %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("FromFS()=%#v; want 2 migrations", got)
+	}
+
+	if got[0].Name != "users" || got[0].SQL != "CREATE TABLE users ();\n\n" || got[0].DownSQL != "DROP TABLE users;\n" {
+		t.Fatalf("first migration=%#v; want users up and down sections", got[0])
+	}
+
+	if !got[1].NoTransaction || got[1].DownSQL != "" {
+		t.Fatalf("second migration=%#v; want no transaction without down SQL", got[1])
+	}
+}
+
+func TestFromFSWithDialectGooseRejectsMissingUp(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"00001_users.sql": {Data: []byte("-- +goose Down\nDROP TABLE users;\n")},
+	}
+
+	if _, err := mig.FromFS(fsys, ".", mig.WithDialect(mig.DialectGoose)); !errors.Is(err, mig.ErrInvalidDirective) {
+		t.Fatalf("FromFS() error=%v; want ErrInvalidDirective", err)
+	}
+}
+
+func TestFromFSWithDialectFlyway(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"V1__Create_users.sql": {Data: []byte("CREATE TABLE users ()")},
+		"U1__Create_users.sql": {Data: []byte("DROP TABLE users")},
+		"V2__Create_posts.sql": {Data: []byte("CREATE TABLE posts ()")},
+		"R__Views.sql":         {Data: []byte("CREATE OR REPLACE VIEW v AS SELECT 1")},
+	}
+
+	var skipped []string
+
+	got, err := mig.FromFS(fsys, ".", mig.WithDialect(mig.DialectFlyway), mig.WithSkipUnknown(),
+		mig.WithOnSkip(func(path string, _ error) {
+			skipped = append(skipped, path)
+		}))
+	if err != nil {
+		t.Fatalf("FromFS(): %v", err)
+	}
+
+	if len(got) != 2 || got[0].Name != "Create_users" || got[0].DownSQL != "DROP TABLE users" ||
+		got[1].Version != 2 {
+		t.Fatalf("FromFS()=%#v; want users with undo SQL and posts", got)
+	}
+
+	if len(skipped) != 1 || skipped[0] != "R__Views.sql" {
+		t.Fatalf("skipped=%v; want repeatable migration", skipped)
+	}
+}
+
+func TestFromFSWithDialectFlywayRejectsDottedVersions(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"V1.1__Create_users.sql": {Data: []byte("CREATE TABLE users ()")},
+	}
+
+	if _, err := mig.FromFS(fsys, ".", mig.WithDialect(mig.DialectFlyway)); !errors.Is(err, mig.ErrInvalidVersion) {
+		t.Fatalf("FromFS() error=%v; want ErrInvalidVersion", err)
+	}
+}
+
+func TestFromFSWithDialectTern(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"001_create_users.sql": {Data: []byte("CREATE TABLE users ();\n---- create above / drop below ----\nDROP TABLE users;\n")},
+	}
+
+	got, err := mig.FromFS(fsys, ".", mig.WithDialect(mig.DialectTern))
+	if err != nil {
+		t.Fatalf("FromFS(): %v", err)
+	}
+
+	if len(got) != 1 || got[0].Name != "create_users" || got[0].SQL != "CREATE TABLE users ();\n" ||
+		got[0].DownSQL != "DROP TABLE users;\n" {
+		t.Fatalf("FromFS()=%#v; want create_users with down SQL", got)
+	}
+}
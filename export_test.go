@@ -0,0 +1,19 @@
+package mig
+
+import (
+	"database/sql"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NewPgxPoolDatabase and NewSQLDatabase expose the built-in adapters to the
+// conformance tests, which cannot be internal tests as migtest imports mig.
+func NewPgxPoolDatabase(conn *pgxpool.Conn, table string) Database {
+	return newPgxDB(newPgxPoolConn(conn), table)
+}
+
+func NewSQLDatabase(conn *sql.Conn, table string) Database {
+	return newPgxDB(newSQLConn(conn), table)
+}
+
+var TestDSN = testDSN
@@ -0,0 +1,136 @@
+package mig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidName is returned by NewMigrationFile for names that would not
+// load back as the generated migration.
+var ErrInvalidName = errors.New("invalid migration name")
+
+// VersionScheme selects how NewMigrationFile numbers new migrations.
+type VersionScheme int
+
+const (
+	// SequentialVersion numbers a new migration one above the highest
+	// existing version, keeping the zero padding of the existing files.
+	SequentialVersion VersionScheme = iota
+
+	// TimestampVersion numbers a new migration with the current UTC time
+	// formatted as YYYYMMDDHHMMSS.
+	TimestampVersion
+)
+
+// timestampVersionLayout is the time layout of TimestampVersion versions.
+const timestampVersionLayout = "20060102150405"
+
+// NewMigrationFile writes an empty migration file called name to the
+// migrations directory dir, numbered according to scheme, and returns its
+// path. The directory is loaded with opts, which also select the file layout
+// of the new migration, such as WithDialect and WithExtensions. The new file
+// is removed again, failing with ErrInvalidName, when it does not load back
+// as a migration called name.
+func NewMigrationFile(dir, name string, scheme VersionScheme, opts ...LoadOption) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, downSuffix) ||
+		strings.HasSuffix(name, upSuffix) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+
+	o, err := newLoadOptions(opts)
+	if err != nil {
+		return "", err
+	}
+
+	ms, err := FromDir(dir, opts...)
+	if err != nil {
+		return "", fmt.Errorf("load migrations: %w", err)
+	}
+
+	var (
+		version uint64
+		width   int
+	)
+
+	switch scheme {
+	case SequentialVersion:
+		version = 1
+
+		for _, m := range ms {
+			version = max(version, m.Version+1)
+
+			if id, _, _ := o.dialect.parseFileName(path.Base(m.Path)); strings.HasPrefix(id, "0") {
+				width = max(width, len(id))
+			}
+		}
+	case TimestampVersion:
+		version, err = strconv.ParseUint(time.Now().UTC().Format(timestampVersionLayout), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("parse timestamp version: %w", err)
+		}
+
+		for _, m := range ms {
+			if m.Version == version {
+				return "", fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+			}
+		}
+	default:
+		return "", fmt.Errorf("unknown version scheme %d", scheme)
+	}
+
+	ext := ".sql"
+	if len(o.extensions) > 0 {
+		ext = o.extensions[0]
+	}
+
+	fileName, content := o.dialect.newFile(width, version, name, ext)
+	p := filepath.Join(dir, fileName)
+
+	if err := writeNewFile(p, content); err != nil {
+		return "", err
+	}
+
+	// The directory is loaded again the way the caller loads it, so that the
+	// new migration is known to load back with the chosen version and name.
+	ms, err = FromDir(dir, opts...)
+	if err == nil && slices.ContainsFunc(ms, func(m Migration) bool {
+		return m.Version == version && m.Name == name && m.Path == fileName
+	}) {
+		return p, nil
+	}
+
+	if removeErr := os.Remove(p); removeErr != nil {
+		return "", errors.Join(fmt.Errorf("%w: %q", ErrInvalidName, name), removeErr)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %w", ErrInvalidName, name, err)
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+}
+
+// writeNewFile writes content to the file p, which must not exist.
+func writeNewFile(p, content string) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("create migration: %w", err)
+	}
+
+	if _, err := f.WriteString(content); err != nil {
+		return errors.Join(fmt.Errorf("write migration: %w", err), f.Close())
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close migration: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package mig_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.acim.net/mig"
+)
+
+func TestNewMigrationFileSequentialKeepsZeroPadding(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "2024"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	for _, name := range []string{"0001-users.sql", "2024/0009-posts.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	got, err := mig.NewMigrationFile(dir, "add-tags", mig.SequentialVersion)
+	if err != nil {
+		t.Fatalf("NewMigrationFile(): %v", err)
+	}
+
+	if want := filepath.Join(dir, "0010-add-tags.sql"); got != want {
+		t.Fatalf("NewMigrationFile()=%q; want %q", got, want)
+	}
+
+	ms, err := mig.FromDir(dir)
+	if err != nil {
+		t.Fatalf("FromDir(): %v", err)
+	}
+
+	if last := ms[len(ms)-1]; last.Version != 10 || last.Name != "add-tags" {
+		t.Fatalf("last migration=%d %q; want 10 add-tags", last.Version, last.Name)
+	}
+}
+
+func TestNewMigrationFileTimestamp(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "1-initial.sql"), []byte("SELECT 1"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	before := time.Now().UTC().Truncate(time.Second)
+
+	if _, err := mig.NewMigrationFile(dir, "add_users", mig.TimestampVersion); err != nil {
+		t.Fatalf("NewMigrationFile(): %v", err)
+	}
+
+	ms, err := mig.FromDir(dir)
+	if err != nil {
+		t.Fatalf("FromDir(): %v", err)
+	}
+
+	if len(ms) != 2 || ms[1].Name != "add_users" {
+		t.Fatalf("FromDir()=%#v; want initial and add_users", ms)
+	}
+
+	created, err := time.Parse("20060102150405", strconv.FormatUint(ms[1].Version, 10))
+	if err != nil {
+		t.Fatalf("parse version %d: %v", ms[1].Version, err)
+	}
+
+	if created.Before(before) || created.After(time.Now().UTC()) {
+		t.Fatalf("version time=%s; want between %s and now", created, before)
+	}
+}
+
+func TestNewMigrationFileRejectsInvalidNames(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"", "a/b", "users.down", "users.up"} {
+		if _, err := mig.NewMigrationFile(dir, name, mig.SequentialVersion); !errors.Is(err, mig.ErrInvalidName) {
+			t.Errorf("NewMigrationFile(%q) error=%v; want ErrInvalidName", name, err)
+		}
+	}
+
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("ReadDir()=%v, %v; want empty directory", entries, err)
+	}
+}
+
+func TestNewMigrationFileWithLoadOptions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	for name, data := range map[string]string{"V001__Create_users.sql": "CREATE TABLE users ()", "README.sql": "-- docs"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	opts := []mig.LoadOption{mig.WithDialect(mig.DialectFlyway), mig.WithSkipUnknown()}
+
+	got, err := mig.NewMigrationFile(dir, "Create_posts", mig.SequentialVersion, opts...)
+	if err != nil {
+		t.Fatalf("NewMigrationFile(): %v", err)
+	}
+
+	if want := filepath.Join(dir, "V002__Create_posts.sql"); got != want {
+		t.Fatalf("NewMigrationFile()=%q; want %q", got, want)
+	}
+}
+
+func TestNewMigrationFileWithDialectGoose(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	if _, err := mig.NewMigrationFile(dir, "users", mig.SequentialVersion, mig.WithDialect(mig.DialectGoose)); err != nil {
+		t.Fatalf("NewMigrationFile(): %v", err)
+	}
+
+	ms, err := mig.FromDir(dir, mig.WithDialect(mig.DialectGoose))
+	if err != nil {
+		t.Fatalf("FromDir(): %v", err)
+	}
+
+	if len(ms) != 1 || ms[0].Path != "1_users.sql" || ms[0].Name != "users" {
+		t.Fatalf("FromDir()=%#v; want 1_users.sql", ms)
+	}
+}
+
+func TestNewMigrationFileRemovesFileNotLoadingBack(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	_, err := mig.NewMigrationFile(dir, "users", mig.SequentialVersion, mig.WithIgnore("*users*"))
+	if !errors.Is(err, mig.ErrInvalidName) {
+		t.Fatalf("NewMigrationFile() error=%v; want ErrInvalidName", err)
+	}
+
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("ReadDir()=%v, %v; want empty directory", entries, err)
+	}
+}
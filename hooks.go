@@ -0,0 +1,81 @@
+package mig
+
+import (
+	"context"
+	"fmt"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// Hooks are callbacks invoked by the built-in adapters around the migrations
+// of a run. Hooks receiving a transaction run inside it, so returning an
+// error rolls back the changes and aborts the run. Any hook may be nil.
+//
+// BeforeAll and AfterAll run once per run, even when there is nothing to
+// apply. BeforeEach and AfterEach run around every applied or reverted
+// migration. For migrations without a transaction they run in transactions
+// of their own, just before and after the migration.
+type Hooks struct {
+	BeforeAll  func(ctx context.Context, tx pgx.Tx) error
+	BeforeEach func(ctx context.Context, tx pgx.Tx, m Migration) error
+	AfterEach  func(ctx context.Context, tx pgx.Tx, m Migration) error
+	AfterAll   func(ctx context.Context, tx pgx.Tx) error
+
+	// OnError is called with the migration which failed, including failures
+	// of BeforeEach and AfterEach, before its transaction is rolled back.
+	OnError func(ctx context.Context, m Migration, err error)
+}
+
+func (h Hooks) beforeAll(ctx context.Context, tx pgx.Tx) error {
+	if h.BeforeAll == nil {
+		return nil
+	}
+
+	if err := h.BeforeAll(ctx, tx); err != nil {
+		return fmt.Errorf("before all hook: %w", err)
+	}
+
+	return nil
+}
+
+func (h Hooks) beforeEach(ctx context.Context, tx pgx.Tx, m Migration) error {
+	if h.BeforeEach == nil {
+		return nil
+	}
+
+	if err := h.BeforeEach(ctx, tx, m); err != nil {
+		return fmt.Errorf("before each hook for migration %d from file %s: %w", m.Version, m.Path, err)
+	}
+
+	return nil
+}
+
+func (h Hooks) afterEach(ctx context.Context, tx pgx.Tx, m Migration) error {
+	if h.AfterEach == nil {
+		return nil
+	}
+
+	if err := h.AfterEach(ctx, tx, m); err != nil {
+		return fmt.Errorf("after each hook for migration %d from file %s: %w", m.Version, m.Path, err)
+	}
+
+	return nil
+}
+
+func (h Hooks) afterAll(ctx context.Context, tx pgx.Tx) error {
+	if h.AfterAll == nil {
+		return nil
+	}
+
+	if err := h.AfterAll(ctx, tx); err != nil {
+		return fmt.Errorf("after all hook: %w", err)
+	}
+
+	return nil
+}
+
+func (h Hooks) onError(ctx context.Context, m Migration, err error) {
+	if h.OnError != nil {
+		h.OnError(ctx, m, err)
+	}
+}
@@ -0,0 +1,122 @@
+package mig
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrIgnored is the reason reported for files and directories skipped
+// because of an ignore pattern.
+var ErrIgnored = errors.New("ignored by pattern")
+
+// LoadOption configures loading migrations from files.
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	ignore      []string
+	extensions  []string
+	skipUnknown bool
+	onSkip      func(path string, reason error)
+	dialect     Dialect
+}
+
+func newLoadOptions(opts []LoadOption) (*loadOptions, error) {
+	o := &loadOptions{ //nolint:exhaustruct
+		extensions: []string{".sql"},
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	for _, pattern := range o.ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("ignore pattern %q: %w", pattern, err)
+		}
+	}
+
+	return o, nil
+}
+
+// WithIgnore skips files and directories with paths relative to the root
+// directory, or names, matching any of patterns. Patterns use the syntax of
+// path.Match, for example "_*.sql" or "drafts".
+func WithIgnore(patterns ...string) LoadOption {
+	return func(o *loadOptions) {
+		o.ignore = append(o.ignore, patterns...)
+	}
+}
+
+// WithExtensions loads files with names ending in any of exts, such as
+// ".pgsql" or ".up.sql", instead of ".sql".
+func WithExtensions(exts ...string) LoadOption {
+	return func(o *loadOptions) {
+		o.extensions = exts
+	}
+}
+
+// WithSkipUnknown skips files without a version prefix, like "README.sql",
+// instead of failing with ErrInvalidVersion.
+func WithSkipUnknown() LoadOption {
+	return func(o *loadOptions) {
+		o.skipUnknown = true
+	}
+}
+
+// WithOnSkip calls fn with the path and the reason of every file skipped
+// because of an ignore pattern, or because it has no version prefix with
+// WithSkipUnknown. Reasons wrap ErrIgnored or ErrInvalidVersion.
+func WithOnSkip(fn func(path string, reason error)) LoadOption {
+	return func(o *loadOptions) {
+		o.onSkip = fn
+	}
+}
+
+// WithDialect loads files in the layout of another migration tool, such as
+// DialectGoose or DialectFlyway, instead of the mig layout.
+func WithDialect(d Dialect) LoadOption {
+	return func(o *loadOptions) {
+		o.dialect = d
+	}
+}
+
+func (o *loadOptions) ignored(relPath string) bool {
+	for _, pattern := range o.ignore {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+
+		if ok, _ := path.Match(pattern, path.Base(relPath)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *loadOptions) hasExtension(name string) bool {
+	for _, ext := range o.extensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *loadOptions) skip(relPath string, reason error) {
+	if o.onSkip != nil {
+		o.onSkip(relPath, reason)
+	}
+}
+
+// relativePath returns the path of file relative to root.
+func relativePath(root, file string) string {
+	if root == "." {
+		return file
+	}
+
+	return strings.TrimPrefix(file, root+"/")
+}
@@ -0,0 +1,107 @@
+package mig_test
+
+import (
+	"errors"
+	"path"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"go.acim.net/mig"
+)
+
+func TestFromFSWithIgnoreSkipsMatchingFiles(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"001-users.sql":         {Data: []byte("CREATE TABLE users ()")},
+		"_helpers.sql":          {Data: []byte("SELECT 1")},
+		"drafts/002-posts.sql":  {Data: []byte("CREATE TABLE posts ()")},
+		"2024/003-tags.sql":     {Data: []byte("CREATE TABLE tags ()")},
+		"2024/_functions.sql":   {Data: []byte("SELECT 2")},
+		"2024/004-notes.sql.gz": {Data: []byte("not loaded")},
+	}
+
+	var skipped []string
+
+	got, err := mig.FromFS(fsys, ".", mig.WithIgnore("_*.sql", "drafts"), mig.WithOnSkip(func(path string, reason error) {
+		if !errors.Is(reason, mig.ErrIgnored) {
+			t.Errorf("skip reason=%v; want ErrIgnored", reason)
+		}
+
+		skipped = append(skipped, path)
+	}))
+	if err != nil {
+		t.Fatalf("FromFS(): %v", err)
+	}
+
+	if len(got) != 2 || got[0].Path != "001-users.sql" || got[1].Path != "2024/003-tags.sql" {
+		t.Fatalf("FromFS() migrations=%#v; want 001-users.sql and 2024/003-tags.sql", got)
+	}
+
+	slices.Sort(skipped)
+
+	if want := []string{"2024/_functions.sql", "_helpers.sql", "drafts"}; !slices.Equal(skipped, want) {
+		t.Fatalf("skipped=%v; want %v", skipped, want)
+	}
+}
+
+func TestFromFSWithExtensions(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"001-users.pgsql":    {Data: []byte("CREATE TABLE users ()")},
+		"002-posts.up.sql":   {Data: []byte("CREATE TABLE posts ()")},
+		"002-posts.down.sql": {Data: []byte("DROP TABLE posts")},
+		"003-tags.sql":       {Data: []byte("CREATE TABLE tags ()")},
+	}
+
+	got, err := mig.FromFS(fsys, ".", mig.WithExtensions(".pgsql", ".up.sql", ".down.sql"))
+	if err != nil {
+		t.Fatalf("FromFS(): %v", err)
+	}
+
+	assertMigrations(t, got, mig.Migrations{
+		{Version: 1, Name: "users", Path: "001-users.pgsql", SQL: "CREATE TABLE users ()"},
+		{Version: 2, Name: "posts", Path: "002-posts.up.sql", SQL: "CREATE TABLE posts ()", DownSQL: "DROP TABLE posts"},
+	})
+}
+
+func TestFromFSSkipsOrRejectsUnknownFiles(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"001-users.sql": {Data: []byte("CREATE TABLE users ()")},
+		"README.sql":    {Data: []byte("-- examples")},
+	}
+
+	if _, err := mig.FromFS(fsys, "."); !errors.Is(err, mig.ErrInvalidVersion) {
+		t.Fatalf("FromFS() error=%v; want ErrInvalidVersion in strict mode", err)
+	}
+
+	var skipped []string
+
+	got, err := mig.FromFS(fsys, ".", mig.WithSkipUnknown(), mig.WithOnSkip(func(path string, reason error) {
+		if !errors.Is(reason, mig.ErrInvalidVersion) {
+			t.Errorf("skip reason=%v; want ErrInvalidVersion", reason)
+		}
+
+		skipped = append(skipped, path)
+	}))
+	if err != nil {
+		t.Fatalf("FromFS(): %v", err)
+	}
+
+	if len(got) != 1 || !slices.Equal(skipped, []string{"README.sql"}) {
+		t.Fatalf("FromFS() migrations=%#v skipped=%v; want 001-users.sql loaded and README.sql skipped", got, skipped)
+	}
+}
+
+func TestFromFSReturnsBadIgnorePatternError(t *testing.T) {
+	t.Parallel()
+
+	_, err := mig.FromFS(fstest.MapFS{}, ".", mig.WithIgnore("["))
+	if !errors.Is(err, path.ErrBadPattern) {
+		t.Fatalf("FromFS() error=%v; want bad pattern error", err)
+	}
+}
@@ -0,0 +1,256 @@
+package mig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// LockMode selects how concurrent runs are kept from migrating at the same
+// time.
+type LockMode int
+
+const (
+	// LockAdvisory holds a PostgreSQL advisory lock during the run. It is
+	// the default.
+	LockAdvisory LockMode = iota
+
+	// LockTable locks the migrations table in EXCLUSIVE mode inside the
+	// migration transaction. It works through connection poolers in
+	// transaction pooling mode, such as PgBouncer, but cannot apply
+	// migrations without a transaction.
+	LockTable
+)
+
+// lockPollInterval is the time between attempts to take the migration lock
+// when a lock timeout is set.
+const lockPollInterval = 100 * time.Millisecond
+
+// lockNotAvailable is the SQLSTATE of statements cancelled by lock_timeout.
+const lockNotAvailable = "55P03"
+
+// uniqueViolation and duplicateTable are the SQLSTATEs of CREATE TABLE IF NOT
+// EXISTS losing a race with a concurrent transaction creating the same table.
+const (
+	uniqueViolation = "23505"
+	duplicateTable  = "42P07"
+)
+
+// createTableAttempts is the number of attempts to create the migrations
+// table in table lock mode.
+const createTableAttempts = 3
+
+// lockScope holds the queries taking the migration advisory lock, waiting for
+// it and without waiting.
+type lockScope struct {
+	name    string
+	lock    string
+	tryLock string
+}
+
+var (
+	transactionLock = lockScope{
+		name:    "transaction",
+		lock:    "SELECT pg_advisory_xact_lock($1)",
+		tryLock: "SELECT pg_try_advisory_xact_lock($1)",
+	}
+	sessionLock = lockScope{
+		name:    "session",
+		lock:    "SELECT pg_advisory_lock($1)",
+		tryLock: "SELECT pg_try_advisory_lock($1)",
+	}
+)
+
+// lock takes the migration advisory lock, waiting at most the lock timeout
+// when one is set.
+func (db *pgxDB) lock(ctx context.Context, exec pgxExecutor, scope lockScope) error {
+	return db.observeLock(ctx, func(ctx context.Context) error {
+		if db.lockTimeout > 0 {
+			return db.tryLock(ctx, exec, scope.tryLock)
+		}
+
+		_, err := exec.Exec(ctx, scope.lock, db.lockID)
+
+		return err
+	}, slog.String("lock_id", db.lockID), slog.String("scope", scope.name))
+}
+
+// lockTable creates the migrations table if needed and locks it until the
+// end of tx, waiting at most the lock timeout when one is set.
+func (db *pgxDB) lockTable(ctx context.Context, tx pgx.Tx) error {
+	return db.observeLock(ctx, func(ctx context.Context) error {
+		for attempt := 1; ; attempt++ {
+			err := db.lockTableInSavepoint(ctx, tx)
+
+			// Concurrent runs creating the table on a fresh database race in
+			// the catalog. Once the winner commits, the table exists.
+			if code := pgErrorCode(err); (code != uniqueViolation && code != duplicateTable) ||
+				attempt == createTableAttempts {
+				return err
+			}
+		}
+	}, slog.String("table", db.table), slog.String("scope", "table"))
+}
+
+// lockTableInSavepoint creates and locks the migrations table in a savepoint
+// of tx, so that the lock holder can still be looked up in tx after a
+// timeout, and that creating the table can be retried.
+func (db *pgxDB) lockTableInSavepoint(ctx context.Context, tx pgx.Tx) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin savepoint: %w", err)
+	}
+
+	err = db.lockTableWithTimeout(ctx, sp)
+
+	switch code := pgErrorCode(err); {
+	case code == lockNotAvailable:
+		if rollbackErr := sp.Rollback(ctx); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("rollback savepoint: %w", rollbackErr))
+		}
+
+		return db.lockTimeoutError(ctx, tx, db.table, `SELECT a.pid, coalesce(a.application_name, ''), a.query_start
+			FROM pg_locks l
+			JOIN pg_stat_activity a ON a.pid = l.pid
+			WHERE l.locktype = 'relation' AND l.granted AND l.pid <> pg_backend_pid()
+				AND l.relation = $1::regclass AND l.mode <> 'AccessShareLock'
+			LIMIT 1`, db.table)
+	case code == uniqueViolation, code == duplicateTable:
+		if rollbackErr := sp.Rollback(ctx); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("rollback savepoint: %w", rollbackErr))
+		}
+
+		return err
+	case err != nil:
+		return err
+	}
+
+	if err := sp.Commit(ctx); err != nil {
+		return fmt.Errorf("release savepoint: %w", err)
+	}
+
+	return nil
+}
+
+func (db *pgxDB) lockTableWithTimeout(ctx context.Context, tx pgx.Tx) error {
+	var previous string
+
+	if db.lockTimeout > 0 {
+		q := "SELECT current_setting('lock_timeout'), set_config('lock_timeout', $1, true)"
+
+		timeout := strconv.FormatInt(max(db.lockTimeout.Milliseconds(), 1), 10)
+
+		if err := tx.QueryRow(ctx, q, timeout).
+			Scan(&previous, nil); err != nil {
+			return fmt.Errorf("set lock timeout: %w", err)
+		}
+	}
+
+	// The table has to exist to be locked. Its other columns are added by
+	// createSchemaMigrationsTable once the lock is held.
+	q := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version bigint PRIMARY KEY)", db.table)
+	if _, err := tx.Exec(ctx, q); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("LOCK TABLE %s IN EXCLUSIVE MODE", db.table)); err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+
+	if db.lockTimeout > 0 {
+		if _, err := tx.Exec(ctx, "SELECT set_config('lock_timeout', $1, true)", previous); err != nil {
+			return fmt.Errorf("restore lock timeout: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// observeLock traces and measures acquire, logging the acquired lock with
+// attrs.
+func (db *pgxDB) observeLock(ctx context.Context, acquire func(ctx context.Context) error, attrs ...any) error {
+	lockCtx, span := db.tracer.Start(ctx, "mig.lock")
+	start := time.Now()
+
+	err := acquire(lockCtx)
+	endSpan(span, err)
+
+	if err != nil {
+		return err
+	}
+
+	db.metrics.LockAcquired(time.Since(start))
+	db.logger.DebugContext(ctx, "migration lock acquired", attrs...)
+
+	return nil
+}
+
+// tryLock polls q until it takes the lock or the lock timeout expires.
+func (db *pgxDB) tryLock(ctx context.Context, exec pgxExecutor, q string) error {
+	deadline := time.Now().Add(db.lockTimeout)
+
+	for {
+		var locked bool
+
+		if err := exec.QueryRow(ctx, q, db.lockID).Scan(&locked); err != nil {
+			return fmt.Errorf("query row: %w", err)
+		}
+
+		if locked {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return db.lockTimeoutError(ctx, exec, db.lockID, `SELECT a.pid, coalesce(a.application_name, ''), a.query_start
+				FROM pg_locks l
+				JOIN pg_stat_activity a ON a.pid = l.pid
+				WHERE l.locktype = 'advisory' AND l.granted AND l.objsubid = 1
+					AND (l.classid::bigint << 32 | l.objid::bigint) = $1::bigint
+				LIMIT 1`, db.lockID)
+		}
+
+		timer := time.NewTimer(min(remaining, lockPollInterval))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// lockTimeoutError returns ErrLockTimeout describing the session holding
+// lock, looked up by holderQuery.
+func (db *pgxDB) lockTimeoutError(ctx context.Context, exec pgxExecutor, lock, holderQuery string, args ...any) error {
+	var (
+		pid             int32
+		applicationName string
+		queryStart      *time.Time
+	)
+
+	err := exec.QueryRow(ctx, holderQuery, args...).Scan(&pid, &applicationName, &queryStart)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w after %s: lock %s was released", ErrLockTimeout, db.lockTimeout, lock)
+	}
+
+	if err != nil {
+		return errors.Join(fmt.Errorf("%w after %s: lock %s", ErrLockTimeout, db.lockTimeout, lock),
+			fmt.Errorf("query lock holder: %w", err))
+	}
+
+	started := "unknown"
+	if queryStart != nil {
+		started = queryStart.Format(time.RFC3339)
+	}
+
+	return fmt.Errorf("%w after %s: lock %s held by pid %d, application %q, query started %s",
+		ErrLockTimeout, db.lockTimeout, lock, pid, applicationName, started)
+}
@@ -0,0 +1,366 @@
+// Package memdb provides an in-memory mig.Database for unit tests of
+// applications using mig, without PostgreSQL.
+package memdb
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.acim.net/mig"
+)
+
+// DB is an in-memory database recording the versions of migrations as they
+// are applied, without running their SQL or functions. Like the built-in
+// adapters, a run is atomic unless its pending migrations include migrations
+// without a transaction, in which case every migration is recorded on its
+// own and a failure of a migration without a transaction marks its version
+// dirty.
+//
+// DB is safe for concurrent use.
+type DB struct {
+	mu       sync.Mutex
+	applied  map[uint64]mig.AppliedMigration
+	failures map[uint64]error
+
+	allowOutOfOrder bool
+	checksumWarn    func(error)
+}
+
+// Option configures a DB. Options of mig.New apply to the built-in adapters
+// only, so DB has options of its own for the behaviour they change.
+type Option func(*DB)
+
+// WithAllowOutOfOrder applies pending migrations with versions lower than the
+// last applied one, like mig.WithAllowOutOfOrder.
+func WithAllowOutOfOrder() Option {
+	return func(db *DB) {
+		db.allowOutOfOrder = true
+	}
+}
+
+// WithChecksumWarnings reports checksum mismatches of applied migrations to
+// warn instead of failing, like mig.WithChecksumWarnings. warn is called
+// holding the lock of DB, so it must not call its methods.
+func WithChecksumWarnings(warn func(err error)) Option {
+	return func(db *DB) {
+		db.checksumWarn = warn
+	}
+}
+
+var (
+	_ mig.Database     = (*DB)(nil)
+	_ mig.Rollbacker   = (*DB)(nil)
+	_ mig.Repairer     = (*DB)(nil)
+	_ mig.Forcer       = (*DB)(nil)
+	_ mig.Planner      = (*DB)(nil)
+	_ mig.StatusReader = (*DB)(nil)
+)
+
+// New returns an empty database configured by opts.
+func New(opts ...Option) *DB {
+	db := &DB{ //nolint:exhaustruct
+		applied:  make(map[uint64]mig.AppliedMigration),
+		failures: make(map[uint64]error),
+	}
+
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	return db
+}
+
+// FailAt makes applying or reverting the migration with version fail with
+// err. A nil err removes the failure.
+func (db *DB) FailAt(version uint64, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err == nil {
+		delete(db.failures, version)
+
+		return
+	}
+
+	db.failures[version] = err
+}
+
+// Versions returns the applied versions in ascending order, including dirty
+// ones.
+func (db *DB) Versions() []uint64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(db.applied))
+}
+
+func (db *DB) Migrate(_ context.Context, ms mig.Migrations) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	steps, err := db.upSteps(ms, maxVersion)
+	if err != nil {
+		return err
+	}
+
+	return db.run(steps, false)
+}
+
+func (db *DB) Plan(_ context.Context, ms mig.Migrations) (mig.Migrations, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.upSteps(ms, maxVersion)
+}
+
+func (db *DB) MigrateTo(_ context.Context, ms mig.Migrations, version uint64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if version >= db.lastVersion() {
+		steps, err := db.upSteps(ms, version)
+		if err != nil {
+			return err
+		}
+
+		return db.run(steps, false)
+	}
+
+	if err := db.checkDirty(); err != nil {
+		return err
+	}
+
+	steps, err := downSteps(ms, slices.DeleteFunc(db.appliedVersions(), func(v uint64) bool { return v <= version }))
+	if err != nil {
+		return err
+	}
+
+	return db.run(steps, true)
+}
+
+func (db *DB) Rollback(_ context.Context, ms mig.Migrations, steps int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.checkDirty(); err != nil {
+		return err
+	}
+
+	applied := db.appliedVersions()
+
+	down, err := downSteps(ms, applied[:min(steps, len(applied))])
+	if err != nil {
+		return err
+	}
+
+	return db.run(down, true)
+}
+
+func (db *DB) Repair(_ context.Context, ms mig.Migrations) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, m := range ms {
+		if a, ok := db.applied[m.Version]; ok {
+			a.Checksum = m.Checksum()
+			db.applied[m.Version] = a
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) Force(_ context.Context, ms mig.Migrations, version uint64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for v, a := range db.applied {
+		if v > version && a.Dirty {
+			delete(db.applied, v)
+		}
+	}
+
+	if version == 0 {
+		return nil
+	}
+
+	m := mig.Migration{Version: version} //nolint:exhaustruct
+	if i := slices.IndexFunc(ms, func(m mig.Migration) bool { return m.Version == version }); i >= 0 {
+		m = ms[i]
+	}
+
+	db.applied[version] = appliedMigration(m, false)
+
+	return nil
+}
+
+func (db *DB) AppliedMigrations(context.Context) ([]mig.AppliedMigration, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return slices.SortedFunc(maps.Values(db.applied), func(a, b mig.AppliedMigration) int {
+		return cmp.Compare(a.Version, b.Version)
+	}), nil
+}
+
+// maxVersion is the highest version mig accepts, the maximum of PostgreSQL
+// bigint.
+const maxVersion = 1<<63 - 1
+
+// upSteps returns the pending migrations with versions not greater than to,
+// after the checks of the built-in adapters.
+func (db *DB) upSteps(ms mig.Migrations, to uint64) (mig.Migrations, error) {
+	if err := db.checkDirty(); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+
+	for _, m := range ms {
+		a, ok := db.applied[m.Version]
+		if !ok || a.Checksum == m.Checksum() {
+			continue
+		}
+
+		err := fmt.Errorf("%w: version %d from file %s", mig.ErrChecksumMismatch, m.Version, m.Path)
+
+		if db.checksumWarn != nil {
+			db.checksumWarn(err)
+
+			continue
+		}
+
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	lastVersion := db.lastVersion()
+
+	var steps mig.Migrations
+
+	for _, m := range ms {
+		if _, ok := db.applied[m.Version]; ok || m.Version > to {
+			continue
+		}
+
+		if m.Version < lastVersion && !db.allowOutOfOrder {
+			errs = append(errs, fmt.Errorf("%w: version %d from file %s is lower than last applied version %d",
+				mig.ErrOutOfOrder, m.Version, m.Path, lastVersion))
+
+			continue
+		}
+
+		steps = append(steps, m)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return steps, nil
+}
+
+// downSteps returns the migrations reverting the given applied versions.
+func downSteps(ms mig.Migrations, versions []uint64) (mig.Migrations, error) {
+	steps := make(mig.Migrations, 0, len(versions))
+
+	for _, v := range versions {
+		i := slices.IndexFunc(ms, func(m mig.Migration) bool { return m.Version == v })
+		if i < 0 {
+			return nil, fmt.Errorf("revert migration %d: %w", v, mig.ErrMissingMigration)
+		}
+
+		if ms[i].DownSQL == "" && ms[i].DownFunc == nil {
+			return nil, fmt.Errorf("revert migration %d from file %s: %w", v, ms[i].Path, mig.ErrIrreversible)
+		}
+
+		steps = append(steps, ms[i])
+	}
+
+	return steps, nil
+}
+
+// run records steps, applying or reverting them. Unless steps contain
+// migrations without a transaction, nothing is recorded when a step fails.
+func (db *DB) run(steps mig.Migrations, down bool) error {
+	perStep := slices.ContainsFunc(steps, func(m mig.Migration) bool { return m.NoTransaction })
+	applied := maps.Clone(db.applied)
+
+	for _, m := range steps {
+		if err, ok := db.failures[m.Version]; ok {
+			if !perStep {
+				return fmt.Errorf("%s migration %d from file %s: %w", verb(down), m.Version, m.Path, err)
+			}
+
+			db.applied = applied
+
+			if m.NoTransaction {
+				db.applied[m.Version] = appliedMigration(m, true)
+			}
+
+			return fmt.Errorf("%s migration %d from file %s: %w", verb(down), m.Version, m.Path, err)
+		}
+
+		if down {
+			delete(applied, m.Version)
+		} else {
+			applied[m.Version] = appliedMigration(m, false)
+		}
+	}
+
+	db.applied = applied
+
+	return nil
+}
+
+func (db *DB) checkDirty() error {
+	for _, v := range db.appliedVersions() {
+		if db.applied[v].Dirty {
+			return fmt.Errorf("%w: version %d, fix it by hand and use Force", mig.ErrDirty, v)
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) lastVersion() uint64 {
+	return slices.Max(append(slices.Collect(maps.Keys(db.applied)), 0))
+}
+
+// appliedVersions returns the applied versions in descending order.
+func (db *DB) appliedVersions() []uint64 {
+	versions := slices.Sorted(maps.Keys(db.applied))
+	slices.Reverse(versions)
+
+	return versions
+}
+
+func appliedMigration(m mig.Migration, dirty bool) mig.AppliedMigration {
+	return mig.AppliedMigration{
+		Version:       m.Version,
+		Name:          m.Name,
+		Path:          m.Path,
+		AppliedAt:     time.Now(),
+		ExecutionTime: 0,
+		AppliedBy:     "memdb",
+		Checksum:      m.Checksum(),
+		Dirty:         dirty,
+	}
+}
+
+func verb(down bool) string {
+	if down {
+		return "revert"
+	}
+
+	return "run"
+}
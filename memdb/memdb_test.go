@@ -0,0 +1,261 @@
+package memdb_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"go.acim.net/mig"
+	"go.acim.net/mig/memdb"
+)
+
+func migrations() mig.Migrations {
+	return mig.Migrations{
+		{Version: 1, Name: "users", Path: "001-users.sql", SQL: "CREATE TABLE users ()", DownSQL: "DROP TABLE users"},
+		{Version: 2, Name: "posts", Path: "002-posts.sql", SQL: "CREATE TABLE posts ()", DownSQL: "DROP TABLE posts"},
+		{Version: 3, Name: "tags", Path: "003-tags.sql", SQL: "CREATE TABLE tags ()", DownSQL: "DROP TABLE tags"},
+	}
+}
+
+func TestMigrateRecordsVersions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := memdb.New()
+	m := mig.New(migrations(), db)
+
+	pending, err := m.Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan(): %v", err)
+	}
+
+	if len(pending) != 3 {
+		t.Fatalf("len(Plan())=%d; want 3", len(pending))
+	}
+
+	for range 2 {
+		if err := m.Migrate(ctx); err != nil {
+			t.Fatalf("Migrate(): %v", err)
+		}
+	}
+
+	if got := db.Versions(); !slices.Equal(got, []uint64{1, 2, 3}) {
+		t.Fatalf("Versions()=%v; want [1 2 3]", got)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status(): %v", err)
+	}
+
+	for _, s := range statuses {
+		if s.State != mig.StateApplied {
+			t.Fatalf("Status()=%#v; want applied", s)
+		}
+	}
+}
+
+func TestMigrateFailsAtVersion(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := memdb.New()
+	failErr := errors.New("boom")
+	db.FailAt(2, failErr)
+
+	m := mig.New(migrations(), db)
+
+	if err := m.Migrate(ctx); !errors.Is(err, failErr) {
+		t.Fatalf("Migrate() error=%v; want injected error", err)
+	}
+
+	if got := db.Versions(); len(got) != 0 {
+		t.Fatalf("Versions()=%v; want run rolled back", got)
+	}
+
+	db.FailAt(2, nil)
+
+	if err := m.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	if got := db.Versions(); !slices.Equal(got, []uint64{1, 2, 3}) {
+		t.Fatalf("Versions()=%v; want [1 2 3]", got)
+	}
+}
+
+func TestMigrateMarksFailedNoTransactionMigrationDirty(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := memdb.New()
+	failErr := errors.New("boom")
+	db.FailAt(2, failErr)
+
+	ms := migrations()
+	ms[1].NoTransaction = true
+	m := mig.New(ms, db)
+
+	if err := m.Migrate(ctx); !errors.Is(err, failErr) {
+		t.Fatalf("Migrate() error=%v; want injected error", err)
+	}
+
+	if err := m.Migrate(ctx); !errors.Is(err, mig.ErrDirty) {
+		t.Fatalf("Migrate() error=%v; want ErrDirty", err)
+	}
+
+	if err := m.Force(ctx, 2); err != nil {
+		t.Fatalf("Force(): %v", err)
+	}
+
+	if err := m.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	if got := db.Versions(); !slices.Equal(got, []uint64{1, 2, 3}) {
+		t.Fatalf("Versions()=%v; want [1 2 3]", got)
+	}
+}
+
+func TestMigrateIsAtomicWhenNoTransactionMigrationsAreApplied(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := memdb.New()
+
+	ms := migrations()
+	ms[0].NoTransaction = true
+
+	if err := mig.New(ms[:1], db).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	failErr := errors.New("boom")
+	db.FailAt(3, failErr)
+
+	if err := mig.New(ms, db).Migrate(ctx); !errors.Is(err, failErr) {
+		t.Fatalf("Migrate() error=%v; want injected error", err)
+	}
+
+	if got := db.Versions(); !slices.Equal(got, []uint64{1}) {
+		t.Fatalf("Versions()=%v; want [1]", got)
+	}
+}
+
+func TestRollbackAndMigrateTo(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := memdb.New()
+	m := mig.New(migrations(), db)
+
+	if err := m.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	if err := m.Rollback(ctx, 2); err != nil {
+		t.Fatalf("Rollback(): %v", err)
+	}
+
+	if got := db.Versions(); !slices.Equal(got, []uint64{1}) {
+		t.Fatalf("Versions()=%v; want [1]", got)
+	}
+
+	if err := m.MigrateTo(ctx, 2); err != nil {
+		t.Fatalf("MigrateTo(): %v", err)
+	}
+
+	if got := db.Versions(); !slices.Equal(got, []uint64{1, 2}) {
+		t.Fatalf("Versions()=%v; want [1 2]", got)
+	}
+
+	ms := migrations()
+	ms[1].DownSQL = ""
+
+	if err := mig.New(ms, db).Rollback(ctx, 1); !errors.Is(err, mig.ErrIrreversible) {
+		t.Fatalf("Rollback() error=%v; want ErrIrreversible", err)
+	}
+}
+
+func TestMigrateDetectsChecksumMismatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := memdb.New()
+
+	if err := mig.New(migrations(), db).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	ms := migrations()
+	ms[0].SQL = "CREATE TABLE people ()"
+	m := mig.New(ms, db)
+
+	if err := m.Migrate(ctx); !errors.Is(err, mig.ErrChecksumMismatch) {
+		t.Fatalf("Migrate() error=%v; want ErrChecksumMismatch", err)
+	}
+
+	if err := m.Repair(ctx); err != nil {
+		t.Fatalf("Repair(): %v", err)
+	}
+
+	if err := m.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+}
+
+func TestWithChecksumWarningsReportsMismatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var warnings []error
+
+	db := memdb.New(memdb.WithChecksumWarnings(func(err error) { warnings = append(warnings, err) }))
+
+	if err := mig.New(migrations(), db).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	ms := migrations()
+	ms[0].SQL = "CREATE TABLE people ()"
+
+	if err := mig.New(ms, db).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	if len(warnings) != 1 || !errors.Is(warnings[0], mig.ErrChecksumMismatch) {
+		t.Fatalf("warnings=%v; want one checksum mismatch", warnings)
+	}
+}
+
+func TestWithAllowOutOfOrderAppliesLowerVersions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := memdb.New(memdb.WithAllowOutOfOrder())
+	ms := migrations()
+
+	if err := mig.New(mig.Migrations{ms[0], ms[2]}, db).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	if err := mig.New(ms, db).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() out of order: %v", err)
+	}
+
+	if got := db.Versions(); !slices.Equal(got, []uint64{1, 2, 3}) {
+		t.Fatalf("Versions()=%v; want [1 2 3]", got)
+	}
+
+	strict := memdb.New()
+
+	if err := mig.New(mig.Migrations{ms[0], ms[2]}, strict).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	if err := mig.New(ms, strict).Migrate(ctx); !errors.Is(err, mig.ErrOutOfOrder) {
+		t.Fatalf("Migrate() error=%v; want ErrOutOfOrder without the option", err)
+	}
+}
@@ -0,0 +1,46 @@
+package mig
+
+import (
+	"errors"
+	"time"
+)
+
+// Metrics records the outcome of migrations run by the built-in adapters.
+// Implementations must be safe for concurrent use. The prommetrics package
+// provides a Prometheus implementation.
+type Metrics interface {
+	// MigrationApplied is called after a migration is applied, or reverted
+	// when down is true. With a single transaction for all migrations, a
+	// later failure still rolls the migration back. It is not called in dry
+	// run mode.
+	MigrationApplied(m Migration, down bool, duration time.Duration)
+
+	// MigrationFailed is called when applying or reverting a migration
+	// fails. code is the SQLSTATE of the PostgreSQL error, or empty for
+	// other errors.
+	MigrationFailed(m Migration, down bool, code string)
+
+	// LockAcquired is called with the time spent waiting for the migration
+	// lock.
+	LockAcquired(wait time.Duration)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) MigrationApplied(Migration, bool, time.Duration) {}
+
+func (noopMetrics) MigrationFailed(Migration, bool, string) {}
+
+func (noopMetrics) LockAcquired(time.Duration) {}
+
+// pgErrorCode returns the SQLSTATE of the PostgreSQL error in err's chain,
+// or an empty string. Besides pgx errors, it recognizes errors of other
+// drivers used through database/sql which have a SQLState method.
+func pgErrorCode(err error) string {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState()
+	}
+
+	return ""
+}
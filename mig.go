@@ -2,37 +2,103 @@ package mig
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	pgx "github.com/jackc/pgx/v5"
 	pgxpool "github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Database interface {
 	Migrate(ctx context.Context, ms Migrations) error
 }
 
-var ErrInvalidTableName = errors.New("invalid table name")
+// Repairer is implemented by databases able to rewrite the checksums
+// recorded for applied migrations.
+type Repairer interface {
+	Repair(ctx context.Context, ms Migrations) error
+}
+
+// Forcer is implemented by databases able to mark a version as cleanly
+// applied after an operator fixed a failed migration by hand.
+type Forcer interface {
+	Force(ctx context.Context, ms Migrations, version uint64) error
+}
+
+// Adopter is implemented by databases able to record the migrations
+// applied by another migration tool, read from its history table.
+type Adopter interface {
+	Adopt(ctx context.Context, ms Migrations, dialect Dialect, table string) error
+}
+
+// Planner is implemented by databases able to list the migrations Migrate
+// would apply, without applying them.
+type Planner interface {
+	Plan(ctx context.Context, ms Migrations) (Migrations, error)
+}
+
+// Rollbacker is implemented by databases able to revert applied migrations
+// using their down SQL.
+type Rollbacker interface {
+	Rollback(ctx context.Context, ms Migrations, steps int) error
+	MigrateTo(ctx context.Context, ms Migrations, version uint64) error
+}
+
+var (
+	ErrInvalidTableName = errors.New("invalid table name")
+	ErrInvalidSteps     = errors.New("invalid number of rollback steps")
+	ErrIrreversible     = errors.New("migration has no down SQL")
+	ErrMissingMigration = errors.New("applied migration not found")
+	ErrChecksumMismatch = errors.New("applied migration checksum mismatch")
+	ErrDirty            = errors.New("dirty migration")
+	ErrOutOfOrder       = errors.New("migration out of order")
+	ErrLockTimeout      = errors.New("timeout waiting for migration lock")
+
+	ErrDryRunNoTransaction    = errors.New("dry run of migration without a transaction")
+	ErrTableLockNoTransaction = errors.New("migration without a transaction in table lock mode")
+)
 
 var tableNamePartPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
 
 type Mig struct {
-	timeout time.Duration
-	ms      Migrations
-	db      Database
-	table   string
-	err     error
+	timeout         time.Duration
+	ms              Migrations
+	db              Database
+	table           string
+	checksumWarn    func(error)
+	appIdentity     string
+	dryRun          bool
+	allowOutOfOrder bool
+	logger          *slog.Logger
+	tracer          trace.Tracer
+	hooks           Hooks
+	metrics         Metrics
+	lockTimeout     time.Duration
+	lockKey         string
+	lockMode        LockMode
+	err             error
+
+	defaultLockTimeout      time.Duration
+	defaultStatementTimeout time.Duration
+
+	retryAttempts int
+	retryBackoff  time.Duration
 }
 
 func New(ms Migrations, db Database, opts ...Option) *Mig {
 	m := &Mig{ //nolint:exhaustruct
-		ms:    ms,
-		db:    db,
-		table: "schema_migrations",
+		ms:      ms,
+		db:      db,
+		table:   "schema_migrations",
+		tracer:  noopTracer(),
+		metrics: noopMetrics{},
 	}
 
 	for _, opt := range opts {
@@ -62,20 +128,53 @@ func FromPgxPool(ms Migrations, pool *pgxpool.Pool, opts ...Option) (*Mig, func(
 		return nil, nil, fmt.Errorf("acquire connection: %w", err)
 	}
 
-	m.db = newPgxDB(newPgxPoolConn(conn), m.table)
+	m.db = m.pgxDatabase(newPgxPoolConn(conn))
 
 	return m, conn.Release, nil
 }
 
+// FromSQLDB reserves a connection from db for migrations with any
+// PostgreSQL driver for database/sql, such as the pgx stdlib driver. The
+// returned function releases the connection. Migration functions and hooks
+// receive a pgx.Tx supporting only Exec, Query, QueryRow and the transaction
+// control methods.
+func FromSQLDB(ms Migrations, db *sql.DB, opts ...Option) (*Mig, func(), error) {
+	m := New(ms, nil, opts...)
+	if m.err != nil {
+		return nil, nil, m.err
+	}
+
+	ctx := context.Background()
+	cancel := func() {}
+
+	if m.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+	}
+
+	defer cancel()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acquire connection: %w", err)
+	}
+
+	m.db = m.pgxDatabase(newSQLConn(conn))
+
+	return m, func() { _ = conn.Close() }, nil
+}
+
 func FromPgx(ms Migrations, conn *pgx.Conn, opts ...Option) *Mig {
 	m := New(ms, nil, opts...)
 
-	m.db = newPgxDB(newPgxConn(conn), m.table)
+	m.db = m.pgxDatabase(newPgxConn(conn))
 
 	return m
 }
 
-func (d *Mig) Migrate(ctx context.Context) error {
+func (d *Mig) Migrate(ctx context.Context) (err error) {
+	ctx, span := d.tracer.Start(ctx, "mig.Migrate")
+	defer func() { endSpan(span, err) }()
+
 	if d.err != nil {
 		return d.err
 	}
@@ -87,6 +186,154 @@ func (d *Mig) Migrate(ctx context.Context) error {
 	return d.db.Migrate(ctx, d.ms)
 }
 
+// Plan returns the migrations Migrate would apply, in order, without applying
+// them.
+func (d *Mig) Plan(ctx context.Context) (Migrations, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if err := d.ms.Validate(); err != nil {
+		return nil, err
+	}
+
+	db, ok := d.db.(Planner)
+	if !ok {
+		return nil, fmt.Errorf("plan: %w", errors.ErrUnsupported)
+	}
+
+	return db.Plan(ctx, d.ms)
+}
+
+// Rollback reverts the last steps applied migrations in reverse order.
+func (d *Mig) Rollback(ctx context.Context, steps int) (err error) {
+	ctx, span := d.tracer.Start(ctx, "mig.Rollback")
+	defer func() { endSpan(span, err) }()
+
+	if steps <= 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidSteps, steps)
+	}
+
+	db, err := d.rollbacker()
+	if err != nil {
+		return err
+	}
+
+	return db.Rollback(ctx, d.ms, steps)
+}
+
+// MigrateTo applies or reverts migrations until version is the last applied
+// one. Version 0 reverts all applied migrations.
+func (d *Mig) MigrateTo(ctx context.Context, version uint64) (err error) {
+	ctx, span := d.tracer.Start(ctx, "mig.MigrateTo")
+	defer func() { endSpan(span, err) }()
+
+	db, err := d.rollbacker()
+	if err != nil {
+		return err
+	}
+
+	return db.MigrateTo(ctx, d.ms, version)
+}
+
+// Repair records the checksums of the current migrations for all applied
+// versions, accepting intentional edits of already applied migrations.
+func (d *Mig) Repair(ctx context.Context) error {
+	if d.err != nil {
+		return d.err
+	}
+
+	if err := d.ms.Validate(); err != nil {
+		return err
+	}
+
+	db, ok := d.db.(Repairer)
+	if !ok {
+		return fmt.Errorf("repair: %w", errors.ErrUnsupported)
+	}
+
+	return db.Repair(ctx, d.ms)
+}
+
+// Force records version as cleanly applied and forgets dirty versions above
+// it. Use it after fixing a failed non-transactional migration by hand:
+// force its version when the change was completed, or the previous version
+// when it was undone so that the migration runs again. Version 0 only
+// forgets dirty versions.
+func (d *Mig) Force(ctx context.Context, version uint64) error {
+	if d.err != nil {
+		return d.err
+	}
+
+	if err := d.ms.Validate(); err != nil {
+		return err
+	}
+
+	if version > maxPostgresBigintVersion {
+		return fmt.Errorf("%w: %d", ErrInvalidVersion, version)
+	}
+
+	db, ok := d.db.(Forcer)
+	if !ok {
+		return fmt.Errorf("force: %w", errors.ErrUnsupported)
+	}
+
+	return db.Force(ctx, d.ms, version)
+}
+
+// Adopt records the migrations applied by the migration tool of dialect as
+// applied, so that switching to mig does not apply them again. The history is
+// read from table or, when it is empty, from the default table of the tool:
+// schema_migrations for golang-migrate, goose_db_version for goose,
+// flyway_schema_history for Flyway and public.schema_version for tern. Adopt
+// fails with ErrDirty when the history records a failed migration, and with
+// ErrMissingMigration when an applied version has no migration.
+func (d *Mig) Adopt(ctx context.Context, dialect Dialect, table string) error {
+	if d.err != nil {
+		return d.err
+	}
+
+	if err := d.ms.Validate(); err != nil {
+		return err
+	}
+
+	if table == "" {
+		table = historyTables[dialect]
+	}
+
+	if table == "" {
+		return fmt.Errorf("adopt %s history: %w", dialect, errors.ErrUnsupported)
+	}
+
+	if err := validateTableName(table); err != nil {
+		return err
+	}
+
+	db, ok := d.db.(Adopter)
+	if !ok {
+		return fmt.Errorf("adopt: %w", errors.ErrUnsupported)
+	}
+
+	return db.Adopt(ctx, d.ms, dialect, table)
+}
+
+func (d *Mig) rollbacker() (Rollbacker, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if err := d.ms.Validate(); err != nil {
+		return nil, err
+	}
+
+	db, ok := d.db.(Rollbacker)
+	if !ok {
+		return nil, fmt.Errorf("rollback: %w", errors.ErrUnsupported)
+	}
+
+	return db, nil
+}
+
 type Option func(*Mig)
 
 func WithCustomTable(name string) Option {
@@ -106,6 +353,133 @@ func WithAcquireConnectionTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithChecksumWarnings reports checksum mismatches of applied migrations to
+// warn instead of failing the migration.
+func WithChecksumWarnings(warn func(err error)) Option {
+	return func(m *Mig) {
+		m.checksumWarn = warn
+	}
+}
+
+// WithAppIdentity appends identity to the database user recorded as the one
+// who applied a migration.
+func WithAppIdentity(identity string) Option {
+	return func(m *Mig) {
+		m.appIdentity = identity
+	}
+}
+
+// WithDryRun executes migrations in a transaction which is rolled back at the
+// end, proving that they apply cleanly without changing the database.
+// Migrations which cannot run in a transaction fail with
+// ErrDryRunNoTransaction.
+func WithDryRun() Option {
+	return func(m *Mig) {
+		m.dryRun = true
+	}
+}
+
+// WithAllowOutOfOrder applies pending migrations with versions lower than the
+// last applied one, instead of failing with ErrOutOfOrder. This happens when
+// branches adding migrations are merged in a different order than their
+// versions.
+func WithAllowOutOfOrder() Option {
+	return func(m *Mig) {
+		m.allowOutOfOrder = true
+	}
+}
+
+// WithLogger logs the progress of migrations to logger. Nothing is logged by
+// default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(m *Mig) {
+		m.logger = logger
+	}
+}
+
+// WithTracerProvider traces Migrate, MigrateTo and Rollback with spans
+// created by a tracer from tp. The built-in adapters add child spans for
+// waiting on the migration lock, reading the last version and running every
+// migration.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(m *Mig) {
+		m.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithHooks runs hooks around the migrations applied or reverted by the
+// built-in adapters.
+func WithHooks(hooks Hooks) Option {
+	return func(m *Mig) {
+		m.hooks = hooks
+	}
+}
+
+// WithMetrics records migrations applied, failures, their durations and the
+// time spent waiting for the migration lock to metrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(m *Mig) {
+		m.metrics = metrics
+	}
+}
+
+// WithLockTimeout fails with ErrLockTimeout, describing the session holding
+// the migration lock, when the lock is not acquired within d. By default
+// mig waits for the lock indefinitely.
+func WithLockTimeout(d time.Duration) Option {
+	return func(m *Mig) {
+		m.lockTimeout = d
+	}
+}
+
+// WithLockKey uses key for the migration advisory lock, instead of the key
+// derived from the database, schema and migrations table names.
+func WithLockKey(key int64) Option {
+	return func(m *Mig) {
+		m.lockKey = strconv.FormatInt(key, 10)
+	}
+}
+
+// WithLockMode selects how concurrent runs are kept from migrating at the
+// same time. The default is LockAdvisory. Use LockTable when connecting
+// through a pooler in transaction pooling mode.
+func WithLockMode(mode LockMode) Option {
+	return func(m *Mig) {
+		m.lockMode = mode
+	}
+}
+
+// WithDefaultLockTimeout sets the PostgreSQL lock_timeout of migrations
+// without a "-- mig:lock_timeout" directive, so that a migration waiting on
+// a lock held by the application fails instead of blocking it. It differs
+// from WithLockTimeout, which bounds the wait for the migration lock.
+func WithDefaultLockTimeout(d time.Duration) Option {
+	return func(m *Mig) {
+		m.defaultLockTimeout = d
+	}
+}
+
+// WithDefaultStatementTimeout sets the PostgreSQL statement_timeout of
+// migrations without a "-- mig:statement_timeout" directive.
+func WithDefaultStatementTimeout(d time.Duration) Option {
+	return func(m *Mig) {
+		m.defaultStatementTimeout = d
+	}
+}
+
+// WithRetry retries migrations failing because their lock_timeout expired,
+// making at most maxAttempts attempts. The delay between attempts starts at
+// backoff and doubles after every attempt, with random jitter. Migrations
+// running in a transaction are retried from a savepoint, so earlier
+// migrations of the run are kept. When every attempt fails, the returned
+// error wraps the errors of all of them.
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return func(m *Mig) {
+		m.retryAttempts = maxAttempts
+		m.retryBackoff = backoff
+	}
+}
+
 func validateTableName(name string) error {
 	parts := strings.Split(name, ".")
 	if len(parts) == 0 || len(parts) > 2 {
@@ -375,6 +375,234 @@ func TestMigrateWrapsSetLastVersionError(t *testing.T) {
 	}
 }
 
+type rollbackerFake struct {
+	dbFake
+
+	steps   int
+	version uint64
+}
+
+func (db *rollbackerFake) Rollback(_ context.Context, _ mig.Migrations, steps int) error {
+	db.steps = steps
+
+	return nil
+}
+
+func (db *rollbackerFake) MigrateTo(_ context.Context, _ mig.Migrations, version uint64) error {
+	db.version = version
+
+	return nil
+}
+
+func TestRollbackDelegatesToDatabase(t *testing.T) {
+	t.Parallel()
+
+	db := &rollbackerFake{} //nolint:exhaustruct
+	m := mig.New(mig.Migrations{}, db)
+
+	if err := m.Rollback(context.Background(), 2); err != nil {
+		t.Fatalf("Rollback(): %v", err)
+	}
+
+	if db.steps != 2 {
+		t.Errorf("Rollback() steps=%d; want %d", db.steps, 2)
+	}
+
+	if err := m.MigrateTo(context.Background(), 5); err != nil {
+		t.Fatalf("MigrateTo(): %v", err)
+	}
+
+	if db.version != 5 {
+		t.Errorf("MigrateTo() version=%d; want %d", db.version, 5)
+	}
+}
+
+func TestRollbackReturnsInvalidStepsError(t *testing.T) {
+	t.Parallel()
+
+	db := &rollbackerFake{} //nolint:exhaustruct
+	m := mig.New(mig.Migrations{}, db)
+
+	err := m.Rollback(context.Background(), 0)
+	if !errors.Is(err, mig.ErrInvalidSteps) {
+		t.Fatalf("Rollback() error=%v; want invalid steps error", err)
+	}
+}
+
+func TestRollbackReturnsUnsupportedError(t *testing.T) {
+	t.Parallel()
+
+	m := mig.New(mig.Migrations{}, &dbFake{}) //nolint:exhaustruct
+
+	if err := m.Rollback(context.Background(), 1); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Rollback() error=%v; want unsupported error", err)
+	}
+
+	if err := m.MigrateTo(context.Background(), 1); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("MigrateTo() error=%v; want unsupported error", err)
+	}
+}
+
+func TestMigrateToReturnsInvalidTableNameError(t *testing.T) {
+	t.Parallel()
+
+	db := &rollbackerFake{} //nolint:exhaustruct
+	m := mig.New(mig.Migrations{}, db, mig.WithCustomTable("bad name"))
+
+	err := m.MigrateTo(context.Background(), 1)
+	if !errors.Is(err, mig.ErrInvalidTableName) {
+		t.Fatalf("MigrateTo() error=%v; want invalid table name error", err)
+	}
+}
+
+type repairerFake struct {
+	dbFake
+
+	repaired mig.Migrations
+}
+
+func (db *repairerFake) Repair(_ context.Context, ms mig.Migrations) error {
+	db.repaired = ms
+
+	return nil
+}
+
+func TestRepairDelegatesToDatabase(t *testing.T) {
+	t.Parallel()
+
+	ms := mig.Migrations{{Version: 1, Path: "001-one.sql", SQL: "SELECT 1"}} //nolint:exhaustruct
+	db := &repairerFake{}                                                    //nolint:exhaustruct
+
+	if err := mig.New(ms, db).Repair(context.Background()); err != nil {
+		t.Fatalf("Repair(): %v", err)
+	}
+
+	if len(db.repaired) != 1 || db.repaired[0].Version != 1 {
+		t.Fatalf("Repair() migrations=%#v; want %#v", db.repaired, ms)
+	}
+}
+
+func TestRepairReturnsUnsupportedError(t *testing.T) {
+	t.Parallel()
+
+	m := mig.New(mig.Migrations{}, &dbFake{}) //nolint:exhaustruct
+
+	if err := m.Repair(context.Background()); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Repair() error=%v; want unsupported error", err)
+	}
+}
+
+type forcerFake struct {
+	dbFake
+
+	forced uint64
+}
+
+func (db *forcerFake) Force(_ context.Context, _ mig.Migrations, version uint64) error {
+	db.forced = version
+
+	return nil
+}
+
+func TestForceDelegatesToDatabase(t *testing.T) {
+	t.Parallel()
+
+	db := &forcerFake{} //nolint:exhaustruct
+
+	if err := mig.New(mig.Migrations{}, db).Force(context.Background(), 3); err != nil {
+		t.Fatalf("Force(): %v", err)
+	}
+
+	if db.forced != 3 {
+		t.Fatalf("Force() version=%d; want %d", db.forced, 3)
+	}
+}
+
+func TestForceReturnsInvalidVersionError(t *testing.T) {
+	t.Parallel()
+
+	db := &forcerFake{} //nolint:exhaustruct
+
+	err := mig.New(mig.Migrations{}, db).Force(context.Background(), 9223372036854775808)
+	if !errors.Is(err, mig.ErrInvalidVersion) {
+		t.Fatalf("Force() error=%v; want invalid version error", err)
+	}
+}
+
+func TestForceReturnsUnsupportedError(t *testing.T) {
+	t.Parallel()
+
+	m := mig.New(mig.Migrations{}, &dbFake{}) //nolint:exhaustruct
+
+	if err := m.Force(context.Background(), 1); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Force() error=%v; want unsupported error", err)
+	}
+}
+
+func TestAdoptReturnsUnsupportedError(t *testing.T) {
+	t.Parallel()
+
+	m := mig.New(mig.Migrations{}, &dbFake{}) //nolint:exhaustruct
+
+	if err := m.Adopt(context.Background(), mig.DialectGoose, ""); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Adopt(goose) error=%v; want unsupported error", err)
+	}
+
+	if err := m.Adopt(context.Background(), mig.DialectMig, ""); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Adopt(mig) error=%v; want unsupported error", err)
+	}
+}
+
+func TestAdoptRejectsInvalidHistoryTable(t *testing.T) {
+	t.Parallel()
+
+	m := mig.New(mig.Migrations{}, &dbFake{}) //nolint:exhaustruct
+
+	if err := m.Adopt(context.Background(), mig.DialectGoose, "goose; DROP"); !errors.Is(err, mig.ErrInvalidTableName) {
+		t.Fatalf("Adopt() error=%v; want invalid table name error", err)
+	}
+}
+
+type plannerFake struct {
+	dbFake
+}
+
+func (db *plannerFake) Plan(_ context.Context, ms mig.Migrations) (mig.Migrations, error) {
+	return ms[db.v:], nil
+}
+
+func TestPlanDelegatesToDatabase(t *testing.T) {
+	t.Parallel()
+
+	ms := mig.Migrations{
+		{Version: 1, Path: "001-one.sql", SQL: "SELECT 1"}, //nolint:exhaustruct
+		{Version: 2, Path: "002-two.sql", SQL: "SELECT 2"}, //nolint:exhaustruct
+	}
+	db := &plannerFake{dbFake{v: 1}} //nolint:exhaustruct
+
+	got, err := mig.New(ms, db).Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Plan(): %v", err)
+	}
+
+	if len(got) != 1 || got[0].Version != 2 {
+		t.Fatalf("Plan()=%#v; want migration 2", got)
+	}
+
+	if db.migrateCalled {
+		t.Fatal("database Migrate called by Plan()")
+	}
+}
+
+func TestPlanReturnsUnsupportedError(t *testing.T) {
+	t.Parallel()
+
+	_, err := mig.New(mig.Migrations{}, &dbFake{}).Plan(context.Background()) //nolint:exhaustruct
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Plan() error=%v; want unsupported error", err)
+	}
+}
+
 func ExampleFromPgxPool() {
 	wd, err := os.Getwd()
 	if err != nil {
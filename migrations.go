@@ -2,91 +2,207 @@ package mig
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 var (
 	ErrInvalidVersion   = errors.New("invalid migration version prefix")
 	ErrDuplicateVersion = errors.New("duplicate version")
+	ErrMissingUp        = errors.New("down migration without up migration")
+	ErrInvalidDirective = errors.New("invalid migration directive")
 )
 
-const maxPostgresBigintVersion = uint64(1<<63 - 1)
+const (
+	maxPostgresBigintVersion = uint64(1<<63 - 1)
+	downSectionMarker        = "-- +mig Down"
+	directivePrefix          = "-- mig:"
+	upSuffix                 = ".up"
+	downSuffix               = ".down"
+)
 
 type Migrations []Migration
 
-func FromDir(path string) (Migrations, error) {
-	files, err := os.ReadDir(path)
+// FromDir loads migrations from the directory path and its subdirectories.
+func FromDir(path string, opts ...LoadOption) (Migrations, error) {
+	return FromFS(os.DirFS(path), ".", opts...)
+}
+
+// FromEmbedFS loads migrations from the directory path of fs and its
+// subdirectories.
+func FromEmbedFS(fs embed.FS, path string, opts ...LoadOption) (Migrations, error) {
+	return FromFS(fs, path, opts...)
+}
+
+// FromFS loads migrations from the directory root of fsys, walking its
+// subdirectories recursively. Migrations are ordered by version across all
+// directories, and their paths are relative to root.
+func FromFS(fsys fs.FS, root string, opts ...LoadOption) (Migrations, error) {
+	o, err := newLoadOptions(opts)
 	if err != nil {
-		return nil, fmt.Errorf("read dir: %w", err)
+		return nil, err
 	}
 
-	fs := os.DirFS(path)
+	var files []string
 
-	return migrations(fs, files, "")
-}
+	if err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
-func FromEmbedFS(fs embed.FS, path string) (Migrations, error) {
-	files, err := fs.ReadDir(path)
-	if err != nil {
+		relPath := relativePath(root, p)
+
+		if p != root && o.ignored(relPath) {
+			o.skip(relPath, fmt.Errorf("%w: %s", ErrIgnored, relPath))
+
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if d.IsDir() || !o.hasExtension(d.Name()) {
+			return nil
+		}
+
+		if id, _, _ := o.dialect.parseFileName(d.Name()); o.skipUnknown && id == "" {
+			o.skip(relPath, fmt.Errorf("%w: %s", ErrInvalidVersion, relPath))
+
+			return nil
+		}
+
+		files = append(files, p)
+
+		return nil
+	}); err != nil {
 		return nil, fmt.Errorf("read dir: %w", err)
 	}
 
-	return migrations(fs, files, path)
+	return migrations(fsys, root, files, o.dialect)
 }
 
-func migrations(fS fs.FS, files []fs.DirEntry, path string) (Migrations, error) {
-	seen := make(map[uint64]bool, len(files))
+func migrations(fsys fs.FS, root string, files []string, dialect Dialect) (Migrations, error) {
+	index := make(map[uint64]int, len(files))
+	hasUp := make(map[uint64]bool, len(files))
+	hasDown := make(map[uint64]bool, len(files))
+	downFiles := make(map[uint64]string, len(files))
+	// downDirectives holds the directives of down migrations, which have to
+	// agree with their up migrations as both share a Migration.
+	downDirectives := make(map[uint64]Migration, len(files))
 	ms := make(Migrations, 0, len(files))
 
 	for _, file := range files {
-		fileName := file.Name()
-		ext := filepath.Ext(fileName)
-
-		if file.IsDir() || ext != ".sql" {
-			continue
-		}
+		fileName := path.Base(file)
+		relPath := relativePath(root, file)
 
-		id := numberPrefix(filepath.Base(fileName))
+		id, name, down := dialect.parseFileName(fileName)
 
 		if len(id) == 0 {
-			return nil, fmt.Errorf("%w: %s", ErrInvalidVersion, filepath.Base(fileName))
+			return nil, fmt.Errorf("%w: %s", ErrInvalidVersion, relPath)
 		}
 
 		version, err := strconv.ParseUint(id, 10, 64)
 		if err != nil || version == 0 || version > maxPostgresBigintVersion {
-			return nil, fmt.Errorf("%w: %s", ErrInvalidVersion, filepath.Base(fileName))
+			return nil, fmt.Errorf("%w: %s", ErrInvalidVersion, relPath)
 		}
 
-		if seen[version] {
-			return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+		sql, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("read file: %w", err)
+		}
+
+		i, ok := index[version]
+		if !ok {
+			i = len(ms)
+			index[version] = i
+
+			ms = append(ms, Migration{Version: version}) //nolint:exhaustruct
+		}
+
+		if down {
+			if hasDown[version] {
+				return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+			}
+
+			d := Migration{Path: relPath} //nolint:exhaustruct
+			if err := parseDirectives(&d, string(sql)); err != nil {
+				return nil, fmt.Errorf("%w in file %s", err, relPath)
+			}
+
+			ms[i].DownSQL = string(sql)
+			hasDown[version] = true
+			downFiles[version] = name
+			downDirectives[version] = d
+
+			continue
 		}
 
-		name := strings.TrimPrefix(fileName, id)
-		name = strings.TrimPrefix(name, "-")
-		name = strings.TrimPrefix(name, "_")
-		name = strings.TrimSuffix(name, ext)
+		if hasUp[version] {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+		}
 
-		sql, err := fs.ReadFile(fS, filepath.Join(path, fileName))
+		sections, err := dialect.split(string(sql))
 		if err != nil {
-			return nil, fmt.Errorf("read file: %w", err)
+			return nil, fmt.Errorf("%w in file %s", err, relPath)
+		}
+
+		if sections.hasDown && hasDown[version] {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
 		}
 
-		ms = append(ms, Migration{
-			Version: version,
-			Name:    name,
-			Path:    fileName,
-			SQL:     string(sql),
-		})
+		ms[i].Name = name
+		ms[i].Path = relPath
+		ms[i].SQL = sections.up
+		ms[i].NoTransaction = sections.noTransaction
 
-		seen[version] = true
+		if err := parseDirectives(&ms[i], sections.up); err != nil {
+			return nil, fmt.Errorf("%w in file %s", err, relPath)
+		}
+
+		if sections.hasDown {
+			d := Migration{Path: relPath} //nolint:exhaustruct
+			if err := parseDirectives(&d, sections.down); err != nil {
+				return nil, fmt.Errorf("%w in the down section of file %s", err, relPath)
+			}
+
+			ms[i].DownSQL = sections.down
+			hasDown[version] = true
+			downDirectives[version] = d
+		}
+
+		hasUp[version] = true
+	}
+
+	for _, m := range ms {
+		if !hasUp[m.Version] {
+			return nil, fmt.Errorf("%w: %d", ErrMissingUp, m.Version)
+		}
+
+		if name, ok := downFiles[m.Version]; ok && name != m.Name {
+			return nil, fmt.Errorf("%w: down migration %d %q does not match %q", ErrMissingUp, m.Version, name, m.Name)
+		}
+
+		if d, ok := downDirectives[m.Version]; ok && conflictingDirectives(m, d) {
+			return nil, fmt.Errorf("%w: down migration %d in file %s does not match the directives of file %s",
+				ErrInvalidDirective, m.Version, d.Path, m.Path)
+		}
 	}
 
 	sort.Sort(&ms)
@@ -106,18 +222,85 @@ func (ms *Migrations) Swap(i, j int) {
 	(*ms)[i], (*ms)[j] = (*ms)[j], (*ms)[i]
 }
 
+// MigrationFunc is a migration written in Go. It runs in the migration
+// transaction.
+type MigrationFunc func(ctx context.Context, tx pgx.Tx) error
+
 type Migration struct {
 	Version uint64
 	Name    string
 	Path    string
 	SQL     string
+	DownSQL string
+	// Func and DownFunc, when set, run instead of SQL and DownSQL.
+	Func     MigrationFunc
+	DownFunc MigrationFunc
+	// NoTransaction runs the migration outside of a transaction, as required
+	// by statements like CREATE INDEX CONCURRENTLY. It is set by the
+	// "-- mig:no-transaction" directive.
+	NoTransaction bool
+	// LockTimeout and StatementTimeout, when positive, are set as the
+	// PostgreSQL lock_timeout and statement_timeout while the migration is
+	// applied or reverted. They are set by the "-- mig:lock_timeout=5s" and
+	// "-- mig:statement_timeout=10m" directives.
+	LockTimeout      time.Duration
+	StatementTimeout time.Duration
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of the migration SQL.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.SQL))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Register returns migrations extended with a Go migration. The down
+// function is optional. Path of the migration is set to the name of the file
+// calling Register.
+func (ms Migrations) Register(version uint64, name string, up, down MigrationFunc) (Migrations, error) {
+	path := ""
+	if _, file, _, ok := runtime.Caller(1); ok {
+		path = filepath.Base(file)
+	}
+
+	if version == 0 || version > maxPostgresBigintVersion {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidVersion, version)
+	}
+
+	if slices.ContainsFunc(ms, func(m Migration) bool { return m.Version == version }) {
+		return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+	}
+
+	registered := append(slices.Clip(ms), Migration{ //nolint:exhaustruct
+		Version:  version,
+		Name:     name,
+		Path:     path,
+		Func:     up,
+		DownFunc: down,
+	})
+
+	sort.Sort(&registered)
+
+	return registered, nil
 }
 
 func (ms Migrations) Validate() error {
+	seen := make(map[uint64]bool, len(ms))
+
 	for _, m := range ms {
 		if m.Version == 0 || m.Version > maxPostgresBigintVersion {
 			return fmt.Errorf("%w: %s", ErrInvalidVersion, m.Path)
 		}
+
+		if seen[m.Version] {
+			return fmt.Errorf("%w: %d", ErrDuplicateVersion, m.Version)
+		}
+
+		if m.NoTransaction && (m.Func != nil || m.DownFunc != nil) {
+			return fmt.Errorf("%w: no-transaction in Go migration %d", ErrInvalidDirective, m.Version)
+		}
+
+		seen[m.Version] = true
 	}
 
 	return nil
@@ -136,3 +319,69 @@ func numberPrefix(s string) string {
 
 	return r.String()
 }
+
+// parseDirectives sets migration fields from "-- mig:" directives found in
+// the comment lines at the beginning of sql.
+func parseDirectives(m *Migration, sql string) error {
+	for line := range strings.Lines(sql) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		directive, ok := strings.CutPrefix(line, directivePrefix)
+		if !ok {
+			continue
+		}
+
+		directive = strings.TrimSpace(directive)
+
+		switch key, value, _ := strings.Cut(directive, "="); key {
+		case "no-transaction":
+			if directive != key {
+				return fmt.Errorf("%w: %s", ErrInvalidDirective, directive)
+			}
+
+			m.NoTransaction = true
+		case "lock_timeout":
+			d, err := parseTimeoutDirective(directive, value)
+			if err != nil {
+				return err
+			}
+
+			m.LockTimeout = d
+		case "statement_timeout":
+			d, err := parseTimeoutDirective(directive, value)
+			if err != nil {
+				return err
+			}
+
+			m.StatementTimeout = d
+		default:
+			return fmt.Errorf("%w: %s", ErrInvalidDirective, directive)
+		}
+	}
+
+	return nil
+}
+
+// conflictingDirectives reports whether down sets directives differing from
+// those of the up migration m. Directives left out of down are taken from m.
+func conflictingDirectives(m, down Migration) bool {
+	return down.NoTransaction && !m.NoTransaction ||
+		down.LockTimeout > 0 && down.LockTimeout != m.LockTimeout ||
+		down.StatementTimeout > 0 && down.StatementTimeout != m.StatementTimeout
+}
+
+func parseTimeoutDirective(directive, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidDirective, directive)
+	}
+
+	return d, nil
+}
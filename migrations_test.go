@@ -1,13 +1,17 @@
 package mig_test
 
 import (
+	"context"
 	"embed"
 	"errors"
 	"os"
 	"path/filepath"
 	"sort"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	pgx "github.com/jackc/pgx/v5"
 	"go.acim.net/mig"
 )
 
@@ -161,6 +165,42 @@ func TestFromDirIgnoresNonMigrationEntries(t *testing.T) {
 	}
 }
 
+func TestFromFSWalksSubdirectories(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"db/migrations/2025/003-tags.sql":       {Data: []byte("CREATE TABLE tags ()")},
+		"db/migrations/2024/001-users.sql":      {Data: []byte("CREATE TABLE users ()")},
+		"db/migrations/2024/001-users.down.sql": {Data: []byte("DROP TABLE users")},
+		"db/migrations/002-posts.sql":           {Data: []byte("CREATE TABLE posts ()")},
+		"db/migrations/2025/README.md":          {Data: []byte("ignored")},
+	}
+
+	got, err := mig.FromFS(fsys, "db/migrations")
+	if err != nil {
+		t.Fatalf("FromFS(): %v", err)
+	}
+
+	assertMigrations(t, got, mig.Migrations{
+		{Version: 1, Name: "users", Path: "2024/001-users.sql", SQL: "CREATE TABLE users ()", DownSQL: "DROP TABLE users"},
+		{Version: 2, Name: "posts", Path: "002-posts.sql", SQL: "CREATE TABLE posts ()"},
+		{Version: 3, Name: "tags", Path: "2025/003-tags.sql", SQL: "CREATE TABLE tags ()"},
+	})
+}
+
+func TestFromFSReturnsDuplicateVersionAcrossDirectories(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"2024/001-users.sql": {Data: []byte("SELECT 1")},
+		"2025/001-posts.sql": {Data: []byte("SELECT 2")},
+	}
+
+	if _, err := mig.FromFS(fsys, "."); !errors.Is(err, mig.ErrDuplicateVersion) {
+		t.Fatalf("FromFS() error=%v; want duplicate version error", err)
+	}
+}
+
 func TestFromDirReturnsDuplicateVersionError(t *testing.T) {
 	t.Parallel()
 
@@ -177,6 +217,341 @@ func TestFromDirReturnsDuplicateVersionError(t *testing.T) {
 	}
 }
 
+func TestFromDirPairsUpAndDownFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, sql := range map[string]string{
+		"001-users.up.sql":   "CREATE TABLE users (id integer)",
+		"001-users.down.sql": "DROP TABLE users",
+		"2-seed.sql":         "INSERT INTO users VALUES (1)",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sql), 0o600); err != nil {
+			t.Fatalf("write migration %s: %v", name, err)
+		}
+	}
+
+	got, err := mig.FromDir(dir)
+	if err != nil {
+		t.Fatalf("FromDir(): %v", err)
+	}
+
+	assertMigrations(t, got, mig.Migrations{
+		{
+			Version: 1,
+			Name:    "users",
+			Path:    "001-users.up.sql",
+			SQL:     "CREATE TABLE users (id integer)",
+			DownSQL: "DROP TABLE users",
+		},
+		{
+			Version: 2,
+			Name:    "seed",
+			Path:    "2-seed.sql",
+			SQL:     "INSERT INTO users VALUES (1)",
+		},
+	})
+}
+
+func TestFromDirSplitsDownSection(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	sql := "CREATE TABLE users (id integer);\n-- +mig Down\nDROP TABLE users;\n"
+	if err := os.WriteFile(filepath.Join(dir, "1-users.sql"), []byte(sql), 0o600); err != nil {
+		t.Fatalf("write migration: %v", err)
+	}
+
+	got, err := mig.FromDir(dir)
+	if err != nil {
+		t.Fatalf("FromDir(): %v", err)
+	}
+
+	assertMigrations(t, got, mig.Migrations{{
+		Version: 1,
+		Name:    "users",
+		Path:    "1-users.sql",
+		SQL:     "CREATE TABLE users (id integer);\n",
+		DownSQL: "DROP TABLE users;\n",
+	}})
+}
+
+func TestFromDirReturnsMissingUpError(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "1-users.down.sql"), []byte("DROP TABLE users"), 0o600); err != nil {
+		t.Fatalf("write migration: %v", err)
+	}
+
+	_, err := mig.FromDir(dir)
+	if !errors.Is(err, mig.ErrMissingUp) {
+		t.Fatalf("FromDir() error=%v; want missing up error", err)
+	}
+}
+
+func TestFromDirReturnsDuplicateVersionErrorForDuplicateDown(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, sql := range map[string]string{
+		"1-users.sql":      "CREATE TABLE users (id integer);\n-- +mig Down\nDROP TABLE users;\n",
+		"1-users.down.sql": "DROP TABLE users",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sql), 0o600); err != nil {
+			t.Fatalf("write migration %s: %v", name, err)
+		}
+	}
+
+	_, err := mig.FromDir(dir)
+	if !errors.Is(err, mig.ErrDuplicateVersion) {
+		t.Fatalf("FromDir() error=%v; want duplicate version error", err)
+	}
+}
+
+func TestFromFSReturnsDuplicateVersionErrorForEmptyDuplicateDown(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"1-a.sql":      {Data: []byte("CREATE TABLE a ()")},
+		"1-a.down.sql": {Data: []byte("")},
+		"1-b.down.sql": {Data: []byte("DROP TABLE a")},
+	}
+
+	if _, err := mig.FromFS(fsys, "."); !errors.Is(err, mig.ErrDuplicateVersion) {
+		t.Fatalf("FromFS() error=%v; want duplicate version error", err)
+	}
+}
+
+func TestFromFSReturnsMissingUpErrorForMismatchedDownName(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"1-users.sql":      {Data: []byte("CREATE TABLE users ()")},
+		"1-posts.down.sql": {Data: []byte("DROP TABLE posts")},
+	}
+
+	if _, err := mig.FromFS(fsys, "."); !errors.Is(err, mig.ErrMissingUp) {
+		t.Fatalf("FromFS() error=%v; want missing up error", err)
+	}
+}
+
+func TestFromDirParsesNoTransactionDirective(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, sql := range map[string]string{
+		"1-index.sql": "-- Build the index without locking writes.\n-- mig:no-transaction\n" +
+			"CREATE INDEX CONCURRENTLY users_email_idx ON users (email);\n",
+		"2-late.sql": "SELECT 1;\n-- mig:no-transaction\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sql), 0o600); err != nil {
+			t.Fatalf("write migration %s: %v", name, err)
+		}
+	}
+
+	got, err := mig.FromDir(dir)
+	if err != nil {
+		t.Fatalf("FromDir(): %v", err)
+	}
+
+	if !got[0].NoTransaction {
+		t.Error("migration 1 NoTransaction=false; want true")
+	}
+
+	if got[1].NoTransaction {
+		t.Error("migration 2 NoTransaction=true; want directive after SQL ignored")
+	}
+}
+
+func TestFromDirParsesTimeoutDirectives(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	sql := "-- mig:lock_timeout=5s\n-- mig:statement_timeout=10m\nALTER TABLE users ADD COLUMN email text;\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "1-email.sql"), []byte(sql), 0o600); err != nil {
+		t.Fatalf("write migration: %v", err)
+	}
+
+	got, err := mig.FromDir(dir)
+	if err != nil {
+		t.Fatalf("FromDir(): %v", err)
+	}
+
+	if got[0].LockTimeout != 5*time.Second || got[0].StatementTimeout != 10*time.Minute {
+		t.Fatalf("LockTimeout=%s StatementTimeout=%s; want 5s and 10m", got[0].LockTimeout, got[0].StatementTimeout)
+	}
+}
+
+func TestFromDirReturnsInvalidDirectiveError(t *testing.T) {
+	t.Parallel()
+
+	for _, directive := range []string{
+		"no-transactions",
+		"no-transaction=true",
+		"lock_timeout",
+		"lock_timeout=5",
+		"statement_timeout=-1s",
+	} {
+		t.Run(directive, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "1-index.sql"), []byte("-- mig:"+directive+"\nSELECT 1"), 0o600); err != nil {
+				t.Fatalf("write migration: %v", err)
+			}
+
+			_, err := mig.FromDir(dir)
+			if !errors.Is(err, mig.ErrInvalidDirective) {
+				t.Fatalf("FromDir() error=%v; want invalid directive error", err)
+			}
+		})
+	}
+}
+
+func TestFromFSParsesDirectivesOfDownMigrations(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"1-index.sql":      {Data: []byte("-- mig:no-transaction\nCREATE INDEX CONCURRENTLY users_idx ON users (id)")},
+		"1-index.down.sql": {Data: []byte("-- mig:no-transaction\nDROP INDEX CONCURRENTLY users_idx")},
+		"2-email.sql":      {Data: []byte("-- mig:lock_timeout=5s\nALTER TABLE users ADD COLUMN email text")},
+		"2-email.down.sql": {Data: []byte("ALTER TABLE users DROP COLUMN email")},
+	}
+
+	got, err := mig.FromFS(fsys, ".")
+	if err != nil {
+		t.Fatalf("FromFS(): %v", err)
+	}
+
+	if !got[0].NoTransaction || got[1].LockTimeout != 5*time.Second {
+		t.Fatalf("FromFS()=%#v; want up directives kept", got)
+	}
+}
+
+func TestFromFSReturnsInvalidDirectiveErrorForDownMigrations(t *testing.T) {
+	t.Parallel()
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"misspelled": {
+			"1-index.sql":      {Data: []byte("CREATE INDEX users_idx ON users (id)")},
+			"1-index.down.sql": {Data: []byte("-- mig:no-transactions\nDROP INDEX users_idx")},
+		},
+		"no transaction only down": {
+			"1-index.sql":      {Data: []byte("CREATE INDEX users_idx ON users (id)")},
+			"1-index.down.sql": {Data: []byte("-- mig:no-transaction\nDROP INDEX CONCURRENTLY users_idx")},
+		},
+		"different timeout": {
+			"1-email.sql":      {Data: []byte("-- mig:lock_timeout=5s\nALTER TABLE users ADD COLUMN email text")},
+			"1-email.down.sql": {Data: []byte("-- mig:lock_timeout=1s\nALTER TABLE users DROP COLUMN email")},
+		},
+		"down section": {
+			"1-index.sql": {Data: []byte("CREATE INDEX users_idx ON users (id)\n-- +mig Down\n" +
+				"-- mig:no-transaction\nDROP INDEX CONCURRENTLY users_idx")},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := mig.FromFS(fsys, "."); !errors.Is(err, mig.ErrInvalidDirective) {
+				t.Fatalf("FromFS() error=%v; want invalid directive error", err)
+			}
+		})
+	}
+}
+
+func TestMigrationsRegister(t *testing.T) {
+	t.Parallel()
+
+	ms, err := mig.FromEmbedFS(ms, "migrations")
+	if err != nil {
+		t.Fatalf("from embed fs: %v", err)
+	}
+
+	up := func(context.Context, pgx.Tx) error { return nil }
+
+	got, err := ms.Register(3, "backfill", up, nil)
+	if err != nil {
+		t.Fatalf("Register(): %v", err)
+	}
+
+	assertMigrations(t, got, append(want(), mig.Migration{ //nolint:exhaustruct
+		Version: 3,
+		Name:    "backfill",
+		Path:    "migrations_test.go",
+		Func:    up,
+	}))
+
+	if len(ms) != 2 {
+		t.Fatalf("len(migrations)=%d after Register(); want original migrations unchanged", len(ms))
+	}
+}
+
+func TestMigrationsRegisterReturnsDuplicateVersionError(t *testing.T) {
+	t.Parallel()
+
+	ms, err := mig.FromEmbedFS(ms, "migrations")
+	if err != nil {
+		t.Fatalf("from embed fs: %v", err)
+	}
+
+	_, err = ms.Register(2, "backfill", func(context.Context, pgx.Tx) error { return nil }, nil)
+	if !errors.Is(err, mig.ErrDuplicateVersion) {
+		t.Fatalf("Register() error=%v; want duplicate version error", err)
+	}
+}
+
+func TestMigrationsRegisterReturnsInvalidVersionError(t *testing.T) {
+	t.Parallel()
+
+	_, err := mig.Migrations{}.Register(0, "backfill", func(context.Context, pgx.Tx) error { return nil }, nil)
+	if !errors.Is(err, mig.ErrInvalidVersion) {
+		t.Fatalf("Register() error=%v; want invalid version error", err)
+	}
+}
+
+func TestMigrationsValidateReturnsDuplicateVersionError(t *testing.T) {
+	t.Parallel()
+
+	err := mig.Migrations{
+		{Version: 1, Path: "001-one.sql", SQL: "SELECT 1"},                                       //nolint:exhaustruct
+		{Version: 1, Name: "backfill", Func: func(context.Context, pgx.Tx) error { return nil }}, //nolint:exhaustruct
+	}.Validate()
+	if !errors.Is(err, mig.ErrDuplicateVersion) {
+		t.Fatalf("Validate() error=%v; want duplicate version error", err)
+	}
+}
+
+func TestMigrationsValidateRejectsNoTransactionGoMigration(t *testing.T) {
+	t.Parallel()
+
+	err := mig.Migrations{{ //nolint:exhaustruct
+		Version:       1,
+		Func:          func(context.Context, pgx.Tx) error { return nil },
+		NoTransaction: true,
+	}}.Validate()
+	if !errors.Is(err, mig.ErrInvalidDirective) {
+		t.Fatalf("Validate() error=%v; want invalid directive error", err)
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	t.Parallel()
+
+	m := mig.Migration{Version: 1, SQL: "SELECT 1"} //nolint:exhaustruct
+
+	const want = "e004ebd5b5532a4b85984a62f8ad48a81aa3460c1ca07701f386135d72cdecf5"
+	if got := m.Checksum(); got != want {
+		t.Fatalf("Checksum()=%s; want %s", got, want)
+	}
+
+	m.SQL = "SELECT 2"
+	if got := m.Checksum(); got == want {
+		t.Fatal("Checksum() did not change with SQL")
+	}
+}
+
 func want() mig.Migrations {
 	return mig.Migrations{
 		{
@@ -220,8 +595,36 @@ func assertMigrations(t *testing.T, got, want mig.Migrations) {
 	}
 
 	for i := range want {
-		if got[i] != want[i] {
+		if comparableMigration(got[i]) != comparableMigration(want[i]) {
 			t.Errorf("migration[%d]=%#v; want %#v", i, got[i], want[i])
 		}
 	}
 }
+
+type migrationFields struct {
+	version       uint64
+	name          string
+	path          string
+	sql           string
+	downSQL       string
+	noTransaction bool
+	hasFunc       bool
+	hasDownFunc   bool
+	lockTimeout   time.Duration
+	stmtTimeout   time.Duration
+}
+
+func comparableMigration(m mig.Migration) migrationFields {
+	return migrationFields{
+		version:       m.Version,
+		name:          m.Name,
+		path:          m.Path,
+		sql:           m.SQL,
+		downSQL:       m.DownSQL,
+		noTransaction: m.NoTransaction,
+		hasFunc:       m.Func != nil,
+		hasDownFunc:   m.DownFunc != nil,
+		lockTimeout:   m.LockTimeout,
+		stmtTimeout:   m.StatementTimeout,
+	}
+}
@@ -0,0 +1,196 @@
+// Package migtest provides tests for custom mig.Database implementations.
+package migtest
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"testing"
+
+	"go.acim.net/mig"
+)
+
+// concurrentCallers is the number of databases migrating at the same time in
+// the concurrency test.
+const concurrentCallers = 4
+
+// NewDatabaseFunc returns a database on a new connection to PostgreSQL,
+// recording migrations in table.
+type NewDatabaseFunc func(t *testing.T, table string) mig.Database
+
+// RunDatabaseConformance checks that the databases returned by newDB behave
+// like the built-in adapters: re-runs are idempotent, migrations apply in
+// order, a failing migration is rolled back and not recorded, concurrent
+// callers apply every migration once, and custom table names are used.
+//
+// newDB is called from the test goroutine, at least once per test, and has
+// to return a database on a connection of its own. Migrations of the tests
+// create tables named after table and drop them when the test passes; newDB
+// should drop table itself in a cleanup of t.
+func RunDatabaseConformance(t *testing.T, newDB NewDatabaseFunc) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, newDB NewDatabaseFunc)
+	}{
+		{name: "idempotent re-runs", run: testIdempotentReRuns},
+		{name: "ordering", run: testOrdering},
+		{name: "rollback on failing migration", run: testRollbackOnFailure},
+		{name: "concurrent callers", run: testConcurrentCallers},
+		{name: "custom table names", run: testCustomTableNames},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newDB)
+		})
+	}
+}
+
+func testIdempotentReRuns(t *testing.T, newDB NewDatabaseFunc) {
+	table := tableName()
+	db := newDB(t, table)
+	ms := mig.Migrations{createLog(table), logVersion(table, 2), logVersion(table, 3)}
+
+	migrate(t, db, ms)
+	migrate(t, db, ms)
+	migrate(t, newDB(t, table), ms)
+
+	migrate(t, db, append(ms, assertLog(table, 4, "count(*) = 2", "re-run applied migrations again")))
+}
+
+func testOrdering(t *testing.T, newDB NewDatabaseFunc) {
+	table := tableName()
+	db := newDB(t, table)
+	ms := mig.Migrations{createLog(table), logVersion(table, 2), logVersion(table, 3), logVersion(table, 4)}
+
+	migrate(t, db, ms)
+
+	ms = append(ms, logVersion(table, 5), logVersion(table, 6))
+	migrate(t, db, ms)
+
+	migrate(t, db, append(ms, assertLog(table, 7, "array_agg(version ORDER BY id) = ARRAY[2, 3, 4, 5, 6]::bigint[]",
+		"migrations applied out of order")))
+}
+
+func testRollbackOnFailure(t *testing.T, newDB NewDatabaseFunc) {
+	table := tableName()
+	db := newDB(t, table)
+
+	failing := logVersion(table, 3)
+	failing.SQL += "; SELECT 1 / 0"
+
+	if err := mig.New(mig.Migrations{createLog(table), logVersion(table, 2), failing}, db).
+		Migrate(context.Background()); err == nil {
+		t.Fatal("Migrate() error=<nil>; want error of failing migration")
+	}
+
+	migrate(t, db, mig.Migrations{
+		createLog(table),
+		logVersion(table, 2),
+		logVersion(table, 3),
+		assertLog(table, 4, "count(*) FILTER (WHERE version = 3) = 1 AND count(*) FILTER (WHERE version = 2) = 1",
+			"failing migration was not rolled back"),
+	})
+}
+
+func testConcurrentCallers(t *testing.T, newDB NewDatabaseFunc) {
+	table := tableName()
+	ms := mig.Migrations{createLog(table), logVersion(table, 2), logVersion(table, 3)}
+	ms[1].SQL = "SELECT pg_sleep(0.1); " + ms[1].SQL
+
+	dbs := make([]mig.Database, concurrentCallers)
+	for i := range dbs {
+		dbs[i] = newDB(t, table)
+	}
+
+	var wg sync.WaitGroup
+
+	for _, db := range dbs {
+		wg.Go(func() {
+			if err := mig.New(ms, db).Migrate(context.Background()); err != nil {
+				t.Errorf("concurrent Migrate(): %v", err)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if t.Failed() {
+		return
+	}
+
+	migrate(t, dbs[0], append(ms, assertLog(table, 4,
+		"count(*) = 2 AND count(DISTINCT version) = 2", "concurrent callers applied migrations more than once")))
+}
+
+func testCustomTableNames(t *testing.T, newDB NewDatabaseFunc) {
+	table := tableName()
+	other := "public." + table + "_other"
+	ms := mig.Migrations{createLog(table), logVersion(table, 2)}
+
+	migrate(t, newDB(t, table), ms)
+	migrate(t, newDB(t, other), ms)
+
+	migrate(t, newDB(t, table), append(ms, assertLog(table, 3,
+		fmt.Sprintf("count(*) = 2 AND to_regclass('%s') IS NOT NULL", other),
+		"migrations table name not respected")))
+}
+
+func migrate(t *testing.T, db mig.Database, ms mig.Migrations) {
+	t.Helper()
+
+	if err := mig.New(ms, db).Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+}
+
+func tableName() string {
+	return "mig_conformance_" + strconv.FormatUint(rand.Uint64(), 36) //nolint:gosec // not a secret
+}
+
+func logTable(table string) string {
+	return table + "_log"
+}
+
+// createLog returns the first migration of every test, creating a table
+// where the following migrations log their versions.
+func createLog(table string) mig.Migration {
+	return mig.Migration{ //nolint:exhaustruct
+		Version: 1,
+		Name:    "create-log",
+		Path:    "001-create-log.sql",
+		SQL: fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id serial PRIMARY KEY, version bigint NOT NULL)",
+			logTable(table)),
+	}
+}
+
+func logVersion(table string, version uint64) mig.Migration {
+	return mig.Migration{ //nolint:exhaustruct
+		Version: version,
+		Name:    "log",
+		Path:    fmt.Sprintf("%03d-log.sql", version),
+		SQL:     fmt.Sprintf("INSERT INTO %s (version) VALUES (%d)", logTable(table), version),
+	}
+}
+
+// assertLog returns a migration failing with message unless condition holds
+// for the rows of the log table. It drops the log table when it succeeds.
+func assertLog(table string, version uint64, condition, message string) mig.Migration {
+	return mig.Migration{ //nolint:exhaustruct
+		Version: version,
+		Name:    "assert",
+		Path:    fmt.Sprintf("%03d-assert.sql", version),
+		SQL: fmt.Sprintf(`DO $$
+BEGIN
+	IF NOT (SELECT %s FROM %s) THEN
+		RAISE EXCEPTION '%s';
+	END IF;
+END
+$$;
+DROP TABLE %s`, condition, logTable(table), message, logTable(table)),
+	}
+}
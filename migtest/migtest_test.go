@@ -0,0 +1,57 @@
+package migtest_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	pgx "github.com/jackc/pgx/v5"
+	"go.acim.net/mig"
+	"go.acim.net/mig/migtest"
+)
+
+// pgxConnDatabase is a custom database migrating through the public pgx
+// connection API, as an application wrapping mig would.
+type pgxConnDatabase struct {
+	conn  *pgx.Conn
+	table string
+}
+
+func (db pgxConnDatabase) Migrate(ctx context.Context, ms mig.Migrations) error {
+	return mig.FromPgx(ms, db.conn, mig.WithCustomTable(db.table)).Migrate(ctx)
+}
+
+func TestRunDatabaseConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	migtest.RunDatabaseConformance(t, func(t *testing.T, table string) mig.Database {
+		t.Helper()
+
+		ctx := context.Background()
+
+		conn, err := pgx.Connect(ctx, testDSN())
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+
+		t.Cleanup(func() {
+			defer conn.Close(ctx) //nolint:errcheck
+
+			if _, err := conn.Exec(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Errorf("drop table %s: %v", table, err)
+			}
+		})
+
+		return pgxConnDatabase{conn: conn, table: table}
+	})
+}
+
+func testDSN() string {
+	if dsn := os.Getenv("MIG_TEST_DSN"); dsn != "" {
+		return dsn
+	}
+
+	return "postgres://postgres@localhost:5432/mig"
+}
@@ -1,35 +1,75 @@
 package mig
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const lockID = 2854263694
 
+// errDryRun rolls back a transaction that completed successfully.
+var errDryRun = errors.New("dry run")
+
+// schemaMigrationsColumns are the columns of the migrations table besides
+// version. Missing columns are added to existing tables before migrating.
+var schemaMigrationsColumns = []string{
+	"name text",
+	"path text",
+	"applied_at timestamptz",
+	"execution_ms bigint",
+	"applied_by text",
+	"checksum text",
+	"dirty boolean NOT NULL DEFAULT false",
+}
+
 type pgxConn interface {
-	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	pgxExecutor
 	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
 type pgxExecutor interface {
 	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
 	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
 }
 
 type pgxDB struct {
-	table         string
-	tableLockName string
-	lockID        string
-	conn          pgxConn
+	table           string
+	tableLockName   string
+	lockID          string
+	conn            pgxConn
+	checksumWarn    func(error)
+	appIdentity     string
+	dryRun          bool
+	allowOutOfOrder bool
+	logger          *slog.Logger
+	tracer          trace.Tracer
+	hooks           Hooks
+	metrics         Metrics
+	lockTimeout     time.Duration
+	lockKey         string
+	lockMode        LockMode
+
+	defaultLockTimeout      time.Duration
+	defaultStatementTimeout time.Duration
+
+	retryAttempts int
+	retryBackoff  time.Duration
 }
 
 func newPgxDB(conn pgxConn, tableName string) *pgxDB {
@@ -37,6 +77,34 @@ func newPgxDB(conn pgxConn, tableName string) *pgxDB {
 		table:         sanitizeTableName(tableName),
 		tableLockName: tableName,
 		conn:          conn,
+		logger:        slog.New(slog.DiscardHandler),
+		tracer:        noopTracer(),
+		metrics:       noopMetrics{},
+	}
+
+	return db
+}
+
+func (m *Mig) pgxDatabase(conn pgxConn) *pgxDB {
+	db := newPgxDB(conn, m.table)
+	db.checksumWarn = m.checksumWarn
+	db.appIdentity = m.appIdentity
+	db.dryRun = m.dryRun
+	db.allowOutOfOrder = m.allowOutOfOrder
+	db.hooks = m.hooks
+
+	db.tracer = m.tracer
+	db.metrics = m.metrics
+	db.lockTimeout = m.lockTimeout
+	db.lockKey = m.lockKey
+	db.lockMode = m.lockMode
+	db.defaultLockTimeout = m.defaultLockTimeout
+	db.defaultStatementTimeout = m.defaultStatementTimeout
+	db.retryAttempts = m.retryAttempts
+	db.retryBackoff = m.retryBackoff
+
+	if m.logger != nil {
+		db.logger = m.logger
 	}
 
 	return db
@@ -47,16 +115,70 @@ func sanitizeTableName(tableName string) string {
 }
 
 func (db *pgxDB) createSchemaMigrationsTable(ctx context.Context, exec pgxExecutor) error {
-	q := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version bigint PRIMARY KEY)", db.table)
+	q := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version bigint PRIMARY KEY, %s)",
+		db.table,
+		strings.Join(schemaMigrationsColumns, ", "),
+	)
 
 	if _, err := exec.Exec(ctx, q); err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
 
+	missing, err := db.missingColumns(ctx, exec)
+	if err != nil {
+		return fmt.Errorf("read columns: %w", err)
+	}
+
+	// ALTER TABLE takes an ACCESS EXCLUSIVE lock, even when every column
+	// exists, blocking readers of the table until the migration commits.
+	if len(missing) > 0 {
+		q = fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s",
+			db.table,
+			strings.Join(missing, ", ADD COLUMN IF NOT EXISTS "),
+		)
+
+		if _, err := exec.Exec(ctx, q); err != nil {
+			return fmt.Errorf("upgrade: %w", err)
+		}
+	}
+
+	db.logger.DebugContext(ctx, "migrations table ready", slog.String("table", db.tableLockName))
+
 	return nil
 }
 
-func (db *pgxDB) lastVersion(ctx context.Context, exec pgxExecutor) (uint64, error) {
+// missingColumns returns the definitions of schemaMigrationsColumns missing
+// in the migrations table, created by an older release.
+func (db *pgxDB) missingColumns(ctx context.Context, exec pgxExecutor) ([]string, error) {
+	rows, err := exec.Query(ctx,
+		"SELECT attname FROM pg_attribute WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped",
+		db.table)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("collect rows: %w", err)
+	}
+
+	var missing []string
+
+	for _, column := range schemaMigrationsColumns {
+		if name, _, _ := strings.Cut(column, " "); !slices.Contains(names, name) {
+			missing = append(missing, column)
+		}
+	}
+
+	return missing, nil
+}
+
+func (db *pgxDB) lastVersion(ctx context.Context, exec pgxExecutor) (_ uint64, err error) {
+	ctx, span := db.tracer.Start(ctx, "mig.last_version")
+	defer func() { endSpan(span, err) }()
+
 	q := "SELECT COALESCE(max(version), 0) FROM " + db.table
 
 	var version uint64
@@ -68,21 +190,602 @@ func (db *pgxDB) lastVersion(ctx context.Context, exec pgxExecutor) (uint64, err
 	return version, nil
 }
 
-func (db *pgxDB) setLastVersion(ctx context.Context, exec pgxExecutor, lastVersion uint64) error {
-	q := fmt.Sprintf("INSERT INTO %s (version) VALUES ($1)", db.table)
+// appliedBy returns the SQL expression of the applied_by column: the
+// database user, followed by the application identity in parameter param
+// when it is not empty.
+func appliedBy(param int) string {
+	return fmt.Sprintf("current_user || coalesce(' (' || nullif($%d::text, '') || ')', '')", param)
+}
+
+func (db *pgxDB) setLastVersion(ctx context.Context, exec pgxExecutor, m Migration, duration time.Duration) error {
+	q := fmt.Sprintf(`INSERT INTO %s (version, name, path, applied_at, execution_ms, applied_by, checksum)
+VALUES ($1, $2, $3, clock_timestamp(), $4, %s, $6)`,
+		db.table, appliedBy(5))
 
-	if _, err := exec.Exec(ctx, q, lastVersion); err != nil {
+	if _, err := exec.Exec(ctx, q, m.Version, m.Name, m.Path, duration.Milliseconds(), db.appIdentity,
+		m.Checksum()); err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
 
 	return nil
 }
 
-func (db *pgxDB) Migrate(ctx context.Context, ms Migrations) (err error) {
+func (db *pgxDB) appliedVersions(ctx context.Context, exec pgxExecutor) ([]uint64, error) {
+	rows, err := exec.Query(ctx, "SELECT version FROM "+db.table+" ORDER BY version DESC")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[uint64])
+	if err != nil {
+		return nil, fmt.Errorf("collect rows: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (db *pgxDB) appliedChecksums(ctx context.Context, exec pgxExecutor) (map[uint64]string, error) {
+	rows, err := exec.Query(ctx, "SELECT version, checksum FROM "+db.table+" WHERE checksum IS NOT NULL")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	checksums := make(map[uint64]string)
+
+	var (
+		version  uint64
+		checksum string
+	)
+
+	if _, err := pgx.ForEachRow(rows, []any{&version, &checksum}, func() error {
+		checksums[version] = checksum
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("collect rows: %w", err)
+	}
+
+	return checksums, nil
+}
+
+// AppliedMigrations reads the migrations table without taking the migration
+// lock or creating the table, so that it never waits for a running migration.
+// It returns no migrations when the table does not exist. Columns missing in
+// tables created by older releases are read as empty.
+func (db *pgxDB) AppliedMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	var exists bool
+
+	if err := db.conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", db.table).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check table: %w", err)
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// Columns are read from the row as JSON, as they may be missing.
+	q := `SELECT t.version, coalesce(r->>'name', ''), coalesce(r->>'path', ''), (r->>'applied_at')::timestamptz,
+	coalesce((r->>'execution_ms')::bigint, 0), coalesce(r->>'applied_by', ''), coalesce(r->>'checksum', ''),
+	coalesce((r->>'dirty')::boolean, false)
+FROM ` + db.table + " t, to_jsonb(t) r ORDER BY t.version"
+
+	rows, err := db.conn.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	var (
+		applied     []AppliedMigration
+		a           AppliedMigration
+		appliedAt   *time.Time
+		executionMS int64
+	)
+
+	if _, err := pgx.ForEachRow(rows, []any{
+		&a.Version, &a.Name, &a.Path, &appliedAt, &executionMS, &a.AppliedBy, &a.Checksum, &a.Dirty,
+	}, func() error {
+		a.AppliedAt = time.Time{}
+		if appliedAt != nil {
+			a.AppliedAt = *appliedAt
+		}
+
+		a.ExecutionTime = time.Duration(executionMS) * time.Millisecond
+		applied = append(applied, a)
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("collect rows: %w", err)
+	}
+
+	return applied, nil
+}
+
+func (db *pgxDB) setChecksum(ctx context.Context, exec pgxExecutor, m Migration) error {
+	q := fmt.Sprintf("UPDATE %s SET checksum = $2 WHERE version = $1", db.table)
+
+	if _, err := exec.Exec(ctx, q, m.Version, m.Checksum()); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+
+	return nil
+}
+
+func (db *pgxDB) setDirty(ctx context.Context, exec pgxExecutor, m Migration) error {
+	q := fmt.Sprintf(`INSERT INTO %s (version, name, path, applied_at, applied_by, checksum, dirty)
+VALUES ($1, $2, $3, clock_timestamp(), %s, $5, true)
+ON CONFLICT (version) DO UPDATE SET dirty = true`,
+		db.table, appliedBy(4))
+
+	if _, err := exec.Exec(ctx, q, m.Version, m.Name, m.Path, db.appIdentity, m.Checksum()); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+
+	return nil
+}
+
+func (db *pgxDB) setClean(ctx context.Context, exec pgxExecutor, m Migration) error {
+	q := fmt.Sprintf(`INSERT INTO %s (version, name, path, applied_at, applied_by, checksum)
+VALUES ($1, $2, $3, clock_timestamp(), %s, $5)
+ON CONFLICT (version) DO UPDATE SET dirty = false`,
+		db.table, appliedBy(4))
+
+	if _, err := exec.Exec(ctx, q, m.Version, m.Name, m.Path, db.appIdentity, m.Checksum()); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+
+	return nil
+}
+
+func (db *pgxDB) dirtyVersions(ctx context.Context, exec pgxExecutor) ([]uint64, error) {
+	rows, err := exec.Query(ctx, "SELECT version FROM "+db.table+" WHERE dirty ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[uint64])
+	if err != nil {
+		return nil, fmt.Errorf("collect rows: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (db *pgxDB) deleteDirtyAbove(ctx context.Context, exec pgxExecutor, version uint64) error {
+	q := fmt.Sprintf("DELETE FROM %s WHERE dirty AND version > $1", db.table)
+
+	if _, err := exec.Exec(ctx, q, version); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+
+	return nil
+}
+
+func (db *pgxDB) deleteVersion(ctx context.Context, exec pgxExecutor, version uint64) error {
+	q := fmt.Sprintf("DELETE FROM %s WHERE version = $1", db.table)
+
+	if _, err := exec.Exec(ctx, q, version); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+
+	return nil
+}
+
+// pgxStep is a migration to apply, or to revert when down is set.
+type pgxStep struct {
+	migration Migration
+	down      bool
+}
+
+// pgxPlanner returns the steps of a run. It is called while holding the
+// migration lock, after making sure the migrations table exists.
+type pgxPlanner func(ctx context.Context, exec pgxExecutor) ([]pgxStep, error)
+
+func (db *pgxDB) Migrate(ctx context.Context, ms Migrations) error {
+	return db.run(ctx, ms, db.migratePlanner(ms))
+}
+
+func (db *pgxDB) Plan(ctx context.Context, ms Migrations) (Migrations, error) {
+	var pending Migrations
+
+	err := db.locked(ctx, func(tx pgx.Tx) error {
+		steps, err := db.migratePlanner(ms)(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range steps {
+			pending = append(pending, s.migration)
+		}
+
+		return errDryRun
+	})
+	if !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+func (db *pgxDB) migratePlanner(ms Migrations) pgxPlanner {
+	return func(ctx context.Context, exec pgxExecutor) ([]pgxStep, error) {
+		if err := db.checkDirty(ctx, exec); err != nil {
+			return nil, err
+		}
+
+		if err := db.verifyChecksums(ctx, exec, ms); err != nil {
+			return nil, err
+		}
+
+		lastVersion, err := db.lastVersion(ctx, exec)
+		if err != nil {
+			return nil, fmt.Errorf("last version: %w", err)
+		}
+
+		applied, err := db.appliedVersions(ctx, exec)
+		if err != nil {
+			return nil, fmt.Errorf("applied versions: %w", err)
+		}
+
+		return db.upSteps(ms, applied, lastVersion, maxPostgresBigintVersion)
+	}
+}
+
+func (db *pgxDB) MigrateTo(ctx context.Context, ms Migrations, version uint64) error {
+	return db.run(ctx, ms, func(ctx context.Context, exec pgxExecutor) ([]pgxStep, error) {
+		if err := db.checkDirty(ctx, exec); err != nil {
+			return nil, err
+		}
+
+		if err := db.verifyChecksums(ctx, exec, ms); err != nil {
+			return nil, err
+		}
+
+		lastVersion, err := db.lastVersion(ctx, exec)
+		if err != nil {
+			return nil, fmt.Errorf("last version: %w", err)
+		}
+
+		applied, err := db.appliedVersions(ctx, exec)
+		if err != nil {
+			return nil, fmt.Errorf("applied versions: %w", err)
+		}
+
+		if version >= lastVersion {
+			return db.upSteps(ms, applied, lastVersion, version)
+		}
+
+		return downSteps(ms, slices.DeleteFunc(applied, func(v uint64) bool { return v <= version }))
+	})
+}
+
+func (db *pgxDB) Rollback(ctx context.Context, ms Migrations, steps int) error {
+	return db.run(ctx, ms, func(ctx context.Context, exec pgxExecutor) ([]pgxStep, error) {
+		if err := db.checkDirty(ctx, exec); err != nil {
+			return nil, err
+		}
+
+		applied, err := db.appliedVersions(ctx, exec)
+		if err != nil {
+			return nil, fmt.Errorf("applied versions: %w", err)
+		}
+
+		return downSteps(ms, applied[:min(steps, len(applied))])
+	})
+}
+
+func (db *pgxDB) Repair(ctx context.Context, ms Migrations) error {
+	return db.locked(ctx, func(tx pgx.Tx) error {
+		applied, err := db.appliedVersions(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("applied versions: %w", err)
+		}
+
+		for _, m := range ms {
+			if !slices.Contains(applied, m.Version) {
+				continue
+			}
+
+			if err := db.setChecksum(ctx, tx, m); err != nil {
+				return fmt.Errorf("set checksum %d: %w", m.Version, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (db *pgxDB) Force(ctx context.Context, ms Migrations, version uint64) error {
+	return db.locked(ctx, func(tx pgx.Tx) error {
+		if err := db.deleteDirtyAbove(ctx, tx, version); err != nil {
+			return fmt.Errorf("delete dirty versions above %d: %w", version, err)
+		}
+
+		if version == 0 {
+			return nil
+		}
+
+		m := Migration{Version: version} //nolint:exhaustruct
+		if i := slices.IndexFunc(ms, func(m Migration) bool { return m.Version == version }); i >= 0 {
+			m = ms[i]
+		}
+
+		if err := db.setClean(ctx, tx, m); err != nil {
+			return fmt.Errorf("set clean version %d: %w", version, err)
+		}
+
+		return nil
+	})
+}
+
+// upSteps returns steps applying migrations which are not applied and have
+// versions not greater than to. Migrations with versions lower than
+// lastVersion fail with ErrOutOfOrder unless allowOutOfOrder is set.
+func (db *pgxDB) upSteps(ms Migrations, applied []uint64, lastVersion, to uint64) ([]pgxStep, error) {
+	var (
+		steps []pgxStep
+		errs  []error
+	)
+
+	for _, m := range ms {
+		if m.Version > to || slices.Contains(applied, m.Version) {
+			continue
+		}
+
+		if m.Version < lastVersion && !db.allowOutOfOrder {
+			errs = append(errs, fmt.Errorf("%w: version %d from file %s is lower than last applied version %d",
+				ErrOutOfOrder, m.Version, m.Path, lastVersion))
+
+			continue
+		}
+
+		steps = append(steps, pgxStep{migration: m, down: false})
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return steps, nil
+}
+
+// downSteps returns steps reverting the given applied versions in order.
+func downSteps(ms Migrations, versions []uint64) ([]pgxStep, error) {
+	steps := make([]pgxStep, 0, len(versions))
+
+	for _, v := range versions {
+		i := slices.IndexFunc(ms, func(m Migration) bool { return m.Version == v })
+		if i < 0 {
+			return nil, fmt.Errorf("revert migration %d: %w", v, ErrMissingMigration)
+		}
+
+		if ms[i].DownSQL == "" && ms[i].DownFunc == nil {
+			return nil, fmt.Errorf("revert migration %d from file %s: %w", v, ms[i].Path, ErrIrreversible)
+		}
+
+		steps = append(steps, pgxStep{migration: ms[i], down: true})
+	}
+
+	return steps, nil
+}
+
+// checkDirty fails when a version is recorded as dirty.
+func (db *pgxDB) checkDirty(ctx context.Context, exec pgxExecutor) error {
+	dirty, err := db.dirtyVersions(ctx, exec)
+	if err != nil {
+		return fmt.Errorf("dirty versions: %w", err)
+	}
+
+	if len(dirty) > 0 {
+		return fmt.Errorf("%w: version %d, fix it by hand and use Force", ErrDirty, dirty[0])
+	}
+
+	return nil
+}
+
+// verifyChecksums compares checksums of applied migrations with the ones
+// recorded when they were applied. Mismatches are reported to checksumWarn
+// when it is set.
+func (db *pgxDB) verifyChecksums(ctx context.Context, exec pgxExecutor, ms Migrations) error {
+	checksums, err := db.appliedChecksums(ctx, exec)
+	if err != nil {
+		return fmt.Errorf("applied checksums: %w", err)
+	}
+
+	var errs []error
+
+	for _, m := range ms {
+		checksum, ok := checksums[m.Version]
+		if !ok || checksum == m.Checksum() {
+			continue
+		}
+
+		err := fmt.Errorf("%w: version %d from file %s", ErrChecksumMismatch, m.Version, m.Path)
+
+		if db.checksumWarn != nil {
+			db.checksumWarn(err)
+
+			continue
+		}
+
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// run plans and executes steps holding the migration lock. All steps share a
+// single transaction, unless pending steps cannot run in a transaction. When
+// ms contains such migrations, the lock is held at session level and the
+// steps are planned first: if any pending step cannot run in a transaction,
+// every other step runs in a transaction of its own, otherwise all of them run
+// in the planning transaction. In dry run and table lock modes the single
+// transaction is always used, and in dry run mode it is rolled back at the
+// end.
+func (db *pgxDB) run(ctx context.Context, ms Migrations, plan pgxPlanner) error {
+	if db.dryRun || db.lockMode == LockTable ||
+		!slices.ContainsFunc(ms, func(m Migration) bool { return m.NoTransaction }) {
+		err := db.locked(ctx, func(tx pgx.Tx) error {
+			steps, err := plan(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			if err := db.hooks.beforeAll(ctx, tx); err != nil {
+				return err
+			}
+
+			if err := db.applySteps(ctx, tx, steps); err != nil {
+				return err
+			}
+
+			if db.dryRun {
+				return errDryRun
+			}
+
+			return nil
+		})
+		if errors.Is(err, errDryRun) {
+			return nil
+		}
+
+		return err
+	}
+
+	return db.sessionLocked(ctx, func() error {
+		var steps []pgxStep
+
+		applied := false
+
+		if err := db.transaction(ctx, func(tx pgx.Tx) (err error) {
+			if err := db.createSchemaMigrationsTable(ctx, tx); err != nil {
+				return fmt.Errorf("create schema migrations table: %w", err)
+			}
+
+			steps, err = plan(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			if err := db.hooks.beforeAll(ctx, tx); err != nil {
+				return err
+			}
+
+			if slices.ContainsFunc(steps, func(s pgxStep) bool { return s.migration.NoTransaction }) {
+				return nil
+			}
+
+			applied = true
+
+			return db.applySteps(ctx, tx, steps)
+		}); err != nil || applied {
+			return err
+		}
+
+		for _, s := range steps {
+			if s.migration.NoTransaction {
+				if err := db.hookedStepWithoutTransaction(ctx, s); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err := db.transaction(ctx, func(tx pgx.Tx) error {
+				return db.hookedStep(ctx, tx, s)
+			}); err != nil {
+				return err
+			}
+		}
+
+		if db.hooks.AfterAll == nil {
+			return nil
+		}
+
+		return db.transaction(ctx, func(tx pgx.Tx) error {
+			return db.hooks.afterAll(ctx, tx)
+		})
+	})
+}
+
+// applySteps executes steps and the AfterAll hook in tx.
+func (db *pgxDB) applySteps(ctx context.Context, tx pgx.Tx, steps []pgxStep) error {
+	for _, s := range steps {
+		if s.migration.NoTransaction && db.dryRun {
+			return fmt.Errorf("dry run migration %d from file %s: %w",
+				s.migration.Version, s.migration.Path, ErrDryRunNoTransaction)
+		}
+
+		if s.migration.NoTransaction {
+			return fmt.Errorf("run migration %d from file %s: %w",
+				s.migration.Version, s.migration.Path, ErrTableLockNoTransaction)
+		}
+
+		if err := db.hookedStep(ctx, tx, s); err != nil {
+			return err
+		}
+	}
+
+	return db.hooks.afterAll(ctx, tx)
+}
+
+// locked runs fn in a transaction holding the migration lock, after making
+// sure the migrations table exists.
+func (db *pgxDB) locked(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	if db.lockMode == LockTable {
+		return db.transaction(ctx, func(tx pgx.Tx) error {
+			if err := db.lockTable(ctx, tx); err != nil {
+				return fmt.Errorf("lock migrations table: %w", err)
+			}
+
+			if err := db.createSchemaMigrationsTable(ctx, tx); err != nil {
+				return fmt.Errorf("create schema migrations table: %w", err)
+			}
+
+			return fn(tx)
+		})
+	}
+
+	if err := db.setLockID(ctx); err != nil {
+		return fmt.Errorf("set lock id: %w", err)
+	}
+
+	return db.transaction(ctx, func(tx pgx.Tx) error {
+		if err := db.lock(ctx, tx, transactionLock); err != nil {
+			return fmt.Errorf("lock migration transaction: %w", err)
+		}
+
+		if err := db.createSchemaMigrationsTable(ctx, tx); err != nil {
+			return fmt.Errorf("create schema migrations table: %w", err)
+		}
+
+		return fn(tx)
+	})
+}
+
+// sessionLocked runs fn holding the migration advisory lock at session level.
+func (db *pgxDB) sessionLocked(ctx context.Context, fn func() error) (err error) {
 	if err := db.setLockID(ctx); err != nil {
 		return fmt.Errorf("set lock id: %w", err)
 	}
 
+	if err := db.lock(ctx, db.conn, sessionLock); err != nil {
+		return fmt.Errorf("lock migration session: %w", err)
+	}
+
+	defer func() {
+		// The lock is released even when ctx is done, as the connection may
+		// return to a pool still holding it.
+		_, unlockErr := db.conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", db.lockID)
+		if unlockErr != nil {
+			err = errors.Join(err, fmt.Errorf("unlock migration session: %w", unlockErr))
+		}
+	}()
+
+	return fn()
+}
+
+// transaction runs fn in a transaction, committing it when fn succeeds.
+func (db *pgxDB) transaction(ctx context.Context, fn func(tx pgx.Tx) error) (err error) {
 	tx, err := db.conn.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("begin migration transaction: %w", err)
@@ -95,48 +798,337 @@ func (db *pgxDB) Migrate(ctx context.Context, ms Migrations) (err error) {
 		}
 
 		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+			db.logger.ErrorContext(ctx, "rollback migration transaction failed", slog.Any("error", rollbackErr))
+
 			err = errors.Join(err, fmt.Errorf("rollback migration transaction: %w", rollbackErr))
 		}
 	}()
 
-	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", db.lockID); err != nil {
-		return fmt.Errorf("lock migration transaction: %w", err)
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		done = true
+		return fmt.Errorf("commit migration transaction: %w", err)
+	}
+
+	done = true
+
+	return nil
+}
+
+// step applies or reverts a single migration and records it in the
+// migrations table.
+func (db *pgxDB) step(ctx context.Context, exec pgxExecutor, s pgxStep) (err error) {
+	m := s.migration
+
+	ctx, span := db.tracer.Start(ctx, "mig.migration", migrationAttributes(m),
+		trace.WithAttributes(attribute.Bool("mig.down", s.down)))
+	defer func() { endSpan(span, err) }()
+
+	attrs := []any{
+		slog.Uint64("version", m.Version),
+		slog.String("name", m.Name),
+		slog.String("path", m.Path),
+	}
+
+	if s.down {
+		db.logger.InfoContext(ctx, "reverting migration", attrs...)
+
+		start := time.Now()
+
+		if err := db.executeWithRetry(ctx, exec, m, m.DownSQL, m.DownFunc); err != nil {
+			db.logger.ErrorContext(ctx, "migration revert failed", append(attrs, slog.Any("error", err))...)
+			db.metrics.MigrationFailed(m, true, pgErrorCode(err))
+
+			return fmt.Errorf("revert migration %d from file %s: %w", m.Version, m.Path, err)
+		}
+
+		duration := time.Since(start)
+
+		if err := db.deleteVersion(ctx, exec, m.Version); err != nil {
+			return fmt.Errorf("delete version %d: %w", m.Version, err)
+		}
+
+		db.logger.InfoContext(ctx, "migration reverted", append(attrs, slog.Duration("duration", duration))...)
+		if !db.dryRun {
+			db.metrics.MigrationApplied(m, true, duration)
+		}
+
+		return nil
+	}
+
+	db.logger.InfoContext(ctx, "applying migration", attrs...)
+
+	start := time.Now()
+
+	if err := db.executeWithRetry(ctx, exec, m, m.SQL, m.Func); err != nil {
+		db.logger.ErrorContext(ctx, "migration failed", append(attrs, slog.Any("error", err))...)
+		db.metrics.MigrationFailed(m, false, pgErrorCode(err))
+
+		return fmt.Errorf("run migration %d from file %s: %w", m.Version, m.Path, err)
+	}
+
+	duration := time.Since(start)
+
+	if err := db.setLastVersion(ctx, exec, m, duration); err != nil {
+		return fmt.Errorf("set last version %d: %w", m.Version, err)
+	}
+
+	db.logger.InfoContext(ctx, "migration applied", append(attrs, slog.Duration("duration", duration))...)
+	if !db.dryRun {
+		db.metrics.MigrationApplied(m, false, duration)
+	}
+
+	return nil
+}
+
+// execute runs fn when it is set, or sql otherwise.
+func execute(ctx context.Context, exec pgxExecutor, sql string, fn MigrationFunc) error {
+	if fn == nil {
+		if _, err := exec.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("execute migration SQL: %w", err)
+		}
+
+		return nil
 	}
 
-	if err := db.createSchemaMigrationsTable(ctx, tx); err != nil {
-		return fmt.Errorf("create schema migrations table: %w", err)
+	tx, ok := exec.(pgx.Tx)
+	if !ok {
+		return errors.New("execute migration function: no transaction")
+	}
+
+	if err := fn(ctx, tx); err != nil {
+		return fmt.Errorf("execute migration function: %w", err)
+	}
+
+	return nil
+}
+
+// hookedStep runs s in tx between the BeforeEach and AfterEach hooks.
+func (db *pgxDB) hookedStep(ctx context.Context, tx pgx.Tx, s pgxStep) error {
+	err := db.hooks.beforeEach(ctx, tx, s.migration)
+	if err == nil {
+		err = db.step(ctx, tx, s)
+	}
+
+	if err == nil {
+		err = db.hooks.afterEach(ctx, tx, s.migration)
 	}
 
-	lastVersion, err := db.lastVersion(ctx, tx)
 	if err != nil {
-		return fmt.Errorf("last version: %w", err)
+		db.hooks.onError(ctx, s.migration, err)
 	}
 
-	for _, m := range ms {
-		if m.Version <= lastVersion {
-			continue
+	return err
+}
+
+// hookedStepWithoutTransaction runs s directly on the connection, with the
+// BeforeEach and AfterEach hooks in transactions of their own.
+func (db *pgxDB) hookedStepWithoutTransaction(ctx context.Context, s pgxStep) error {
+	var err error
+
+	if db.hooks.BeforeEach != nil {
+		err = db.transaction(ctx, func(tx pgx.Tx) error {
+			return db.hooks.beforeEach(ctx, tx, s.migration)
+		})
+	}
+
+	if err == nil {
+		err = db.stepWithoutTransaction(ctx, s)
+	}
+
+	if err == nil && db.hooks.AfterEach != nil {
+		err = db.transaction(ctx, func(tx pgx.Tx) error {
+			return db.hooks.afterEach(ctx, tx, s.migration)
+		})
+	}
+
+	if err != nil {
+		db.hooks.onError(ctx, s.migration, err)
+	}
+
+	return err
+}
+
+// executeWithRetry executes a migration, retrying attempts which fail on
+// lock_timeout when retries are enabled. In a transaction every attempt runs
+// in a savepoint, so that a failed attempt does not abort the transaction.
+func (db *pgxDB) executeWithRetry(ctx context.Context, exec pgxExecutor, m Migration, sql string, fn MigrationFunc) error {
+	if db.retryAttempts <= 1 {
+		return db.withTimeouts(ctx, exec, m, func() error {
+			return execute(ctx, exec, sql, fn)
+		})
+	}
+
+	var errs []error
+
+	for attempt := 1; ; attempt++ {
+		err := db.executeAttempt(ctx, exec, m, sql, fn)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, fmt.Errorf("attempt %d: %w", attempt, err))
+
+		if pgErrorCode(err) != lockNotAvailable {
+			return errors.Join(errs...)
+		}
+
+		if attempt >= db.retryAttempts {
+			return fmt.Errorf("give up after %d attempts: %w", attempt, errors.Join(errs...))
 		}
 
-		if _, err := tx.Exec(ctx, m.SQL); err != nil {
-			return fmt.Errorf("run migration %d from file %s: execute migration SQL: %w", m.Version, m.Path, err)
+		delay := retryDelay(db.retryBackoff, attempt)
+
+		db.logger.WarnContext(ctx, "retrying migration after lock timeout",
+			slog.Uint64("version", m.Version),
+			slog.String("name", m.Name),
+			slog.String("path", m.Path),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.Any("error", err))
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return errors.Join(append(errs, ctx.Err())...)
+		case <-timer.C:
 		}
+	}
+}
 
-		if err := db.setLastVersion(ctx, tx, m.Version); err != nil {
-			return fmt.Errorf("set last version %d: %w", m.Version, err)
+func (db *pgxDB) executeAttempt(ctx context.Context, exec pgxExecutor, m Migration, sql string, fn MigrationFunc) error {
+	tx, ok := exec.(pgx.Tx)
+	if !ok {
+		return db.withTimeouts(ctx, exec, m, func() error {
+			return execute(ctx, exec, sql, fn)
+		})
+	}
+
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin savepoint: %w", err)
+	}
+
+	if err := db.withTimeouts(ctx, sp, m, func() error {
+		return execute(ctx, sp, sql, fn)
+	}); err != nil {
+		if rollbackErr := sp.Rollback(ctx); rollbackErr != nil {
+			err = errors.Join(err, fmt.Errorf("rollback savepoint: %w", rollbackErr))
 		}
+
+		return err
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		done = true
-		return fmt.Errorf("commit migration transaction: %w", err)
+	if err := sp.Commit(ctx); err != nil {
+		return fmt.Errorf("release savepoint: %w", err)
 	}
 
-	done = true
+	return nil
+}
+
+// retryDelay returns the exponential backoff before the attempt following
+// attempt, with half of it randomized.
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	d := backoff << min(attempt-1, 30) //nolint:mnd // keeps the shift from overflowing
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + rand.N(d/2+1) //nolint:gosec // jitter does not need a secure source
+}
+
+// withTimeouts runs fn with the lock and statement timeouts of m, or the
+// default ones, restoring the previous values afterwards.
+func (db *pgxDB) withTimeouts(ctx context.Context, exec pgxExecutor, m Migration, fn func() error) error {
+	lockTimeout := cmp.Or(m.LockTimeout, db.defaultLockTimeout)
+	statementTimeout := cmp.Or(m.StatementTimeout, db.defaultStatementTimeout)
+
+	if lockTimeout <= 0 && statementTimeout <= 0 {
+		return fn()
+	}
+
+	// In a transaction the timeouts are set locally. Migrations without one
+	// change them for the session.
+	_, local := exec.(pgx.Tx)
+
+	var previousLockTimeout, previousStatementTimeout string
+
+	q := "SELECT current_setting('lock_timeout'), current_setting('statement_timeout')"
+	if err := exec.QueryRow(ctx, q).Scan(&previousLockTimeout, &previousStatementTimeout); err != nil {
+		return fmt.Errorf("query timeouts: %w", err)
+	}
+
+	if err := setTimeouts(ctx, exec, local, timeoutSetting(lockTimeout, previousLockTimeout),
+		timeoutSetting(statementTimeout, previousStatementTimeout)); err != nil {
+		return fmt.Errorf("set timeouts: %w", err)
+	}
+
+	err := fn()
+	if err != nil && local {
+		// The failed transaction is rolled back together with the timeouts.
+		return err
+	}
+
+	// Session timeouts are restored even when ctx is cancelled, as the
+	// connection may be returned to a pool afterwards.
+	if restoreErr := setTimeouts(context.WithoutCancel(ctx), exec, local, previousLockTimeout,
+		previousStatementTimeout); restoreErr != nil {
+		err = errors.Join(err, fmt.Errorf("restore timeouts: %w", restoreErr))
+	}
+
+	return err
+}
+
+func setTimeouts(ctx context.Context, exec pgxExecutor, local bool, lockTimeout, statementTimeout string) error {
+	q := "SELECT set_config('lock_timeout', $1, $3), set_config('statement_timeout', $2, $3)"
+	if _, err := exec.Exec(ctx, q, lockTimeout, statementTimeout, local); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
 
 	return nil
 }
 
+// timeoutSetting formats d in milliseconds, or returns previous when d is
+// not set.
+func timeoutSetting(d time.Duration, previous string) string {
+	if d <= 0 {
+		return previous
+	}
+
+	return strconv.FormatInt(max(d.Milliseconds(), 1), 10)
+}
+
+// stepWithoutTransaction runs a step directly on the connection. A failed
+// step may leave the schema partially changed, so its version is recorded as
+// dirty.
+func (db *pgxDB) stepWithoutTransaction(ctx context.Context, s pgxStep) error {
+	err := db.step(ctx, db.conn, s)
+	if err == nil {
+		return nil
+	}
+
+	// The version is marked dirty even when ctx is done, as the migration may
+	// have been partially applied.
+	if dirtyErr := db.setDirty(context.WithoutCancel(ctx), db.conn, s.migration); dirtyErr != nil {
+		err = errors.Join(err, fmt.Errorf("set dirty version %d: %w", s.migration.Version, dirtyErr))
+	}
+
+	return err
+}
+
 func (db *pgxDB) setLockID(ctx context.Context) error {
+	if db.lockKey != "" {
+		db.lockID = db.lockKey
+
+		return nil
+	}
+
 	q := "SELECT CURRENT_DATABASE(), CURRENT_SCHEMA()"
 
 	var database, schema string
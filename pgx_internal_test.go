@@ -1,27 +1,40 @@
 package mig
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"log/slog"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 const dsn = "postgres://postgres@localhost:5432/mig"
 
 var (
-	_ pgxConn  = (*pgx.Conn)(nil)
-	_ pgxConn  = (*pgxpool.Conn)(nil)
-	_ Database = (*pgxDB)(nil)
+	_ pgxConn      = (*pgx.Conn)(nil)
+	_ pgxConn      = (*pgxpool.Conn)(nil)
+	_ Database     = (*pgxDB)(nil)
+	_ Rollbacker   = (*pgxDB)(nil)
+	_ Repairer     = (*pgxDB)(nil)
+	_ StatusReader = (*pgxDB)(nil)
+	_ Forcer       = (*pgxDB)(nil)
+	_ Planner      = (*pgxDB)(nil)
 )
 
 func TestPgxLockIDUsesCanonicalTableName(t *testing.T) {
@@ -61,6 +74,226 @@ func TestPgxLockIDUsesCanonicalTableName(t *testing.T) {
 	}
 }
 
+func TestPgxLockIDUsesLockKey(t *testing.T) {
+	t.Parallel()
+
+	migrator := New(nil, nil, WithLockKey(-42))
+	db := migrator.pgxDatabase(lockIdentityConn{database: "mig", schema: "public"})
+
+	if err := db.setLockID(context.Background()); err != nil {
+		t.Fatalf("setLockID(): %v", err)
+	}
+
+	if db.lockID != "-42" {
+		t.Fatalf("lockID=%s; want -42", db.lockID)
+	}
+}
+
+func TestPgxStepLogsMigration(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+
+	db := newPgxDB(lockIdentityConn{database: "mig", schema: "public"}, "schema_migrations")
+	db.logger = slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})) //nolint:exhaustruct
+
+	m := Migration{Version: 7, Name: "users", Path: "007-users.sql", SQL: "SELECT 1"} //nolint:exhaustruct
+
+	if err := db.step(context.Background(), executorFake{}, pgxStep{migration: m, down: false}); err != nil {
+		t.Fatalf("step(): %v", err)
+	}
+
+	failErr := errors.New("exec failed")
+	if err := db.step(context.Background(), executorFake{err: failErr}, pgxStep{migration: m, down: false}); !errors.Is(err, failErr) {
+		t.Fatalf("step() error=%v; want exec error", err)
+	}
+
+	for _, want := range []string{
+		`"msg":"applying migration","version":7,"name":"users","path":"007-users.sql"`,
+		`"msg":"migration applied","version":7,"name":"users","path":"007-users.sql","duration":`,
+		`"msg":"migration failed","version":7,"name":"users","path":"007-users.sql","error":`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs=%s; want %s", logs.String(), want)
+		}
+	}
+}
+
+func TestPgxStepRecordsMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := &metricsFake{}
+
+	db := newPgxDB(lockIdentityConn{database: "mig", schema: "public"}, "schema_migrations")
+	db.metrics = metrics
+
+	m := Migration{Version: 7, Name: "users", Path: "007-users.sql", SQL: "SELECT 1"} //nolint:exhaustruct
+
+	if err := db.step(context.Background(), executorFake{}, pgxStep{migration: m, down: false}); err != nil {
+		t.Fatalf("step(): %v", err)
+	}
+
+	pgErr := &pgconn.PgError{Code: "42601"} //nolint:exhaustruct
+	if err := db.step(context.Background(), executorFake{err: pgErr}, pgxStep{migration: m, down: false}); !errors.Is(err, pgErr) {
+		t.Fatalf("step() error=%v; want exec error", err)
+	}
+
+	if !slices.Equal(metrics.applied, []uint64{7}) {
+		t.Fatalf("applied=%v; want [7]", metrics.applied)
+	}
+
+	if !slices.Equal(metrics.failures, []string{"42601"}) {
+		t.Fatalf("failures=%v; want [42601]", metrics.failures)
+	}
+}
+
+func TestPgxStepSkipsAppliedMetricInDryRun(t *testing.T) {
+	t.Parallel()
+
+	metrics := &metricsFake{}
+
+	db := newPgxDB(lockIdentityConn{database: "mig", schema: "public"}, "schema_migrations")
+	db.metrics = metrics
+	db.dryRun = true
+
+	m := Migration{Version: 7, Name: "users", Path: "007-users.sql", SQL: "SELECT 1", DownSQL: "SELECT 2"} //nolint:exhaustruct
+
+	for _, down := range []bool{false, true} {
+		if err := db.step(context.Background(), executorFake{}, pgxStep{migration: m, down: down}); err != nil {
+			t.Fatalf("step(down=%t): %v", down, err)
+		}
+	}
+
+	if len(metrics.applied) != 0 {
+		t.Fatalf("applied=%v; want none in dry run", metrics.applied)
+	}
+}
+
+func TestPgxStepRetriesLockTimeout(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+
+	migrator := New(nil, nil, WithRetry(3, time.Millisecond),
+		WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	db := migrator.pgxDatabase(lockIdentityConn{database: "mig", schema: "public"})
+
+	m := Migration{Version: 7, Name: "users", Path: "007-users.sql", SQL: "ALTER TABLE users ADD email text"} //nolint:exhaustruct
+	lockErr := &pgconn.PgError{Code: lockNotAvailable, Message: "canceling statement due to lock timeout"}    //nolint:exhaustruct
+
+	exec := &failingExecutor{failures: 2, err: lockErr}
+	if err := db.step(context.Background(), exec, pgxStep{migration: m, down: false}); err != nil {
+		t.Fatalf("step(): %v", err)
+	}
+
+	// Three attempts and recording the version.
+	if exec.calls != 4 {
+		t.Fatalf("calls=%d; want 4", exec.calls)
+	}
+
+	if n := strings.Count(logs.String(), `"msg":"retrying migration after lock timeout"`); n != 2 {
+		t.Fatalf("retry logs=%d; want 2 in %s", n, logs.String())
+	}
+
+	exec = &failingExecutor{failures: 5, err: lockErr}
+
+	err := db.step(context.Background(), exec, pgxStep{migration: m, down: false})
+	if !strings.Contains(err.Error(), "give up after 3 attempts") {
+		t.Fatalf("step() error=%v; want give up after 3 attempts", err)
+	}
+
+	if n := strings.Count(err.Error(), "lock timeout"); n != 3 {
+		t.Fatalf("step() error=%v; want all three lock timeout errors", err)
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != lockNotAvailable {
+		t.Fatalf("step() error=%v; want PgError %s", err, lockNotAvailable)
+	}
+
+	syntaxErr := &pgconn.PgError{Code: "42601"} //nolint:exhaustruct
+	exec = &failingExecutor{failures: 5, err: syntaxErr}
+
+	if err := db.step(context.Background(), exec, pgxStep{migration: m, down: false}); !errors.Is(err, syntaxErr) {
+		t.Fatalf("step() error=%v; want syntax error", err)
+	}
+
+	if exec.calls != 1 {
+		t.Fatalf("calls=%d; want syntax error not retried", exec.calls)
+	}
+}
+
+func TestPgxSessionLockedUnlocksAfterContextCancellation(t *testing.T) {
+	t.Parallel()
+
+	conn := &cancelAwareConn{} //nolint:exhaustruct
+	db := newPgxDB(conn, "schema_migrations")
+	db.lockKey = "42"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := db.sessionLocked(ctx, func() error {
+		cancel()
+
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("sessionLocked() error=%v; want context canceled", err)
+	}
+
+	if len(conn.executed) != 2 || !strings.Contains(conn.executed[1], "pg_advisory_unlock") {
+		t.Fatalf("executed=%q; want lock and unlock", conn.executed)
+	}
+}
+
+func TestPgxStepWithoutTransactionSetsDirtyAfterContextCancellation(t *testing.T) {
+	t.Parallel()
+
+	conn := &cancelAwareConn{} //nolint:exhaustruct
+	db := newPgxDB(conn, "schema_migrations")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := db.stepWithoutTransaction(ctx, pgxStep{migration: Migration{ //nolint:exhaustruct
+		Version:       1,
+		Path:          "001-index.sql",
+		SQL:           "CREATE INDEX CONCURRENTLY users_idx ON users (id)",
+		NoTransaction: true,
+	}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("stepWithoutTransaction() error=%v; want context canceled", err)
+	}
+
+	if len(conn.executed) != 1 || !strings.Contains(conn.executed[0], "dirty") {
+		t.Fatalf("executed=%q; want dirty version recorded", conn.executed)
+	}
+}
+
+func TestPgxWithTimeoutsRestoresSessionTimeoutsAfterContextCancellation(t *testing.T) {
+	t.Parallel()
+
+	conn := &cancelAwareConn{} //nolint:exhaustruct
+	db := newPgxDB(conn, "schema_migrations")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := db.withTimeouts(ctx, conn, Migration{Version: 1, LockTimeout: 5 * time.Second}, //nolint:exhaustruct
+		func() error {
+			cancel()
+
+			return ctx.Err()
+		})
+	if !errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "restore timeouts") {
+		t.Fatalf("withTimeouts() error=%v; want context canceled with timeouts restored", err)
+	}
+
+	if len(conn.executed) != 2 || !strings.Contains(conn.executed[1], "set_config") {
+		t.Fatalf("executed=%q; want timeouts set and restored", conn.executed)
+	}
+}
+
 func TestPgxMigrateWrapsBeginError(t *testing.T) {
 	t.Parallel()
 
@@ -488,64 +721,1885 @@ func TestPgxMigrateUsesMaxVersionFromAppendOnlyHistory(t *testing.T) {
 	}
 }
 
-func pgxPool(ctx context.Context, t *testing.T) *pgxpool.Pool {
-	t.Helper()
+func TestPgxMigrateToRevertsAndReappliesMigrations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
 
-	cfg, err := pgxpool.ParseConfig(testDSN())
+	ctx := context.Background()
+	tableName := testTableName(t, "migrate_to_versions")
+	first := testTableName(t, "migrate_to_first")
+	second := testTableName(t, "migrate_to_second")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, first)
+		dropTable(ctx, t, pool, second)
+	})
+
+	conn, err := pool.Acquire(ctx)
 	if err != nil {
-		t.Fatalf("parse config: %v", err)
+		t.Fatalf("acquire connection: %v", err)
 	}
+	defer conn.Release()
 
-	pool, err := pgxpool.NewWithConfig(ctx, cfg)
-	if err != nil {
-		t.Fatalf("connect config: %v", err)
+	migrator := New(Migrations{
+		{
+			Version: 1,
+			Path:    "001-first.sql",
+			SQL:     "CREATE TABLE " + first + " (id integer)",
+			DownSQL: "DROP TABLE " + first,
+		},
+		{
+			Version: 2,
+			Path:    "002-second.sql",
+			SQL:     "CREATE TABLE " + second + " (id integer)",
+			DownSQL: "DROP TABLE " + second,
+		},
+	}, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.MigrateTo(ctx, 1); err != nil {
+		t.Fatalf("MigrateTo(1): %v", err)
 	}
 
-	t.Cleanup(pool.Close)
+	if !tableExists(ctx, t, pool, first) || tableExists(ctx, t, pool, second) {
+		t.Fatal("MigrateTo(1) want only first migration applied")
+	}
 
-	return pool
-}
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
 
-func testDSN() string {
-	if dsn := os.Getenv("MIG_TEST_DSN"); dsn != "" {
-		return dsn
+	if err := migrator.MigrateTo(ctx, 0); err != nil {
+		t.Fatalf("MigrateTo(0): %v", err)
 	}
 
-	return dsn
+	if tableExists(ctx, t, pool, first) || tableExists(ctx, t, pool, second) {
+		t.Fatal("MigrateTo(0) want all migrations reverted")
+	}
+
+	var count int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM "+tableName).Scan(&count); err != nil {
+		t.Fatalf("count migration versions: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("migration versions count=%d; want 0", count)
+	}
 }
 
-func testTableName(t *testing.T, prefix string) string {
-	t.Helper()
+func TestPgxRollbackRevertsSteps(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
 
-	return fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
-}
+	ctx := context.Background()
+	tableName := testTableName(t, "rollback_versions")
+	first := testTableName(t, "rollback_first")
+	second := testTableName(t, "rollback_second")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, first)
+		dropTable(ctx, t, pool, second)
+	})
 
-func dropTable(ctx context.Context, t *testing.T, pool *pgxpool.Pool, tableName string) {
-	t.Helper()
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
 
-	if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS "+tableName); err != nil {
-		t.Fatalf("drop table %s: %v", tableName, err)
+	migrator := New(Migrations{
+		{
+			Version: 1,
+			Path:    "001-first.sql",
+			SQL:     "CREATE TABLE " + first + " (id integer)",
+		},
+		{
+			Version: 2,
+			Path:    "002-second.sql",
+			SQL:     "CREATE TABLE " + second + " (id integer)",
+			DownSQL: "DROP TABLE " + second,
+		},
+	}, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
 	}
-}
 
-func tableExists(ctx context.Context, t *testing.T, pool *pgxpool.Pool, tableName string) bool {
-	t.Helper()
+	if err := migrator.Rollback(ctx, 1); err != nil {
+		t.Fatalf("Rollback(1): %v", err)
+	}
 
-	var exists bool
-	if err := pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", tableName).Scan(&exists); err != nil {
-		t.Fatalf("check table %s exists: %v", tableName, err)
+	if !tableExists(ctx, t, pool, first) || tableExists(ctx, t, pool, second) {
+		t.Fatal("Rollback(1) want only second migration reverted")
 	}
 
-	return exists
+	err = migrator.Rollback(ctx, 1)
+	if !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("Rollback(1) error=%v; want irreversible error", err)
+	}
+
+	if !tableExists(ctx, t, pool, first) {
+		t.Fatal("first migration reverted; want failed rollback to keep it")
+	}
 }
 
-type lockIdentityConn struct {
-	database string
-	schema   string
+func TestPgxMigrateDetectsChecksumMismatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "checksum_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	ms := Migrations{{
+		Version: 1,
+		Path:    "001-select.sql",
+		SQL:     "SELECT 1",
+	}}
+
+	if err := New(ms, newPgxDB(newPgxPoolConn(conn), tableName)).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	ms[0].SQL = "SELECT 2"
+
+	err = New(ms, newPgxDB(newPgxPoolConn(conn), tableName)).Migrate(ctx)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Migrate() error=%v; want checksum mismatch error", err)
+	}
+
+	if !strings.Contains(err.Error(), "version 1 from file 001-select.sql") {
+		t.Fatalf("Migrate() error=%q; want version and path", err)
+	}
+
+	var warnings []error
+	migrator := New(ms, nil, WithChecksumWarnings(func(err error) {
+		warnings = append(warnings, err)
+	}))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() with checksum warnings: %v", err)
+	}
+
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrChecksumMismatch) {
+		t.Fatalf("checksum warnings=%v; want one checksum mismatch", warnings)
+	}
+
+	if err := migrator.Repair(ctx); err != nil {
+		t.Fatalf("Repair(): %v", err)
+	}
+
+	if err := New(ms, newPgxDB(newPgxPoolConn(conn), tableName)).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() after repair: %v", err)
+	}
 }
 
-func (conn lockIdentityConn) QueryRow(context.Context, string, ...any) pgx.Row {
-	return lockIdentityRow(conn)
+func TestPgxMigrateUpgradesLegacyTableAndRecordsMetadata(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "legacy_versions")
+	pool := pgxPool(ctx, t)
+	dropTable(ctx, t, pool, tableName)
+	if _, err := pool.Exec(ctx, "CREATE TABLE "+tableName+" (version bigint PRIMARY KEY)"); err != nil {
+		t.Fatalf("create legacy migration table %s: %v", tableName, err)
+	}
+	if _, err := pool.Exec(ctx, "INSERT INTO "+tableName+" (version) VALUES (1)"); err != nil {
+		t.Fatalf("seed legacy migration table %s: %v", tableName, err)
+	}
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	migrator := New(Migrations{
+		{
+			Version: 1,
+			Name:    "legacy",
+			Path:    "001-legacy.sql",
+			SQL:     "SELECT 1",
+		},
+		{
+			Version: 2,
+			Name:    "next",
+			Path:    "002-next.sql",
+			SQL:     "SELECT 2",
+		},
+	}, nil, WithAppIdentity("billing"))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	var (
+		name, path, appliedBy, checksum string
+		executionMS                     int64
+		appliedAt                       time.Time
+	)
+
+	if err := pool.QueryRow(ctx,
+		"SELECT name, path, applied_at, execution_ms, applied_by, checksum FROM "+tableName+" WHERE version = 2",
+	).Scan(&name, &path, &appliedAt, &executionMS, &appliedBy, &checksum); err != nil {
+		t.Fatalf("read migration metadata: %v", err)
+	}
+
+	if name != "next" || path != "002-next.sql" {
+		t.Fatalf("name=%q path=%q; want next and 002-next.sql", name, path)
+	}
+
+	if appliedAt.IsZero() || executionMS < 0 {
+		t.Fatalf("applied_at=%v execution_ms=%d; want recorded values", appliedAt, executionMS)
+	}
+
+	if !strings.HasSuffix(appliedBy, " (billing)") {
+		t.Fatalf("applied_by=%q; want app identity suffix", appliedBy)
+	}
+
+	if checksum != migrator.ms[1].Checksum() {
+		t.Fatalf("checksum=%q; want %q", checksum, migrator.ms[1].Checksum())
+	}
+
+	var legacyName *string
+	if err := pool.QueryRow(ctx, "SELECT name FROM "+tableName+" WHERE version = 1").Scan(&legacyName); err != nil {
+		t.Fatalf("read legacy migration metadata: %v", err)
+	}
+
+	if legacyName != nil {
+		t.Fatalf("legacy name=%q; want NULL", *legacyName)
+	}
+}
+
+func TestPgxStatusListsAppliedAndPendingMigrations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "status_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	db := newPgxDB(newPgxPoolConn(conn), tableName)
+	ms := Migrations{{
+		Version: 1,
+		Name:    "one",
+		Path:    "001-one.sql",
+		SQL:     "SELECT 1",
+	}}
+
+	if err := New(ms, db).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	ms = append(ms, Migration{
+		Version: 2,
+		Name:    "two",
+		Path:    "002-two.sql",
+		SQL:     "SELECT 2",
+	})
+
+	statuses, err := New(ms, db).Status(ctx)
+	if err != nil {
+		t.Fatalf("Status(): %v", err)
+	}
+
+	if len(statuses) != 2 {
+		t.Fatalf("len(Status())=%d; want 2", len(statuses))
+	}
+
+	if statuses[0].State != StateApplied || statuses[0].Applied == nil || statuses[0].Applied.AppliedAt.IsZero() {
+		t.Fatalf("Status()[0]=%#v; want applied migration with metadata", statuses[0])
+	}
+
+	if statuses[1].State != StatePending || statuses[1].Applied != nil {
+		t.Fatalf("Status()[1]=%#v; want pending migration", statuses[1])
+	}
+}
+
+func TestPgxStatusReadsWithoutLockingOrCreatingTable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "status_plain_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	db := newPgxDB(newPgxPoolConn(conn), tableName)
+	ms := Migrations{{Version: 1, Name: "one", Path: "001-one.sql", SQL: "SELECT 1"}}
+
+	statuses, err := New(ms, db).Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() without table: %v", err)
+	}
+
+	if len(statuses) != 1 || statuses[0].State != StatePending {
+		t.Fatalf("Status()=%#v; want pending migration", statuses)
+	}
+
+	if tableExists(ctx, t, pool, tableName) {
+		t.Fatalf("Status() created table %s", tableName)
+	}
+
+	// A legacy table only has the version column.
+	if _, err := pool.Exec(ctx, "CREATE TABLE "+tableName+" (version bigint PRIMARY KEY); INSERT INTO "+
+		tableName+" VALUES (1)"); err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+
+	if err := db.setLockID(ctx); err != nil {
+		t.Fatalf("set lock id: %v", err)
+	}
+
+	holder, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire lock holder connection: %v", err)
+	}
+	defer holder.Release()
+
+	if _, err := holder.Exec(ctx, "SELECT pg_advisory_lock($1)", db.lockID); err != nil {
+		t.Fatalf("hold migration lock: %v", err)
+	}
+	defer holder.Exec(ctx, "SELECT pg_advisory_unlock($1)", db.lockID) //nolint:errcheck
+
+	statusCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	statuses, err = New(ms, db).Status(statusCtx)
+	if err != nil {
+		t.Fatalf("Status() with legacy table and held lock: %v", err)
+	}
+
+	if len(statuses) != 1 || statuses[0].State != StateApplied || statuses[0].Applied.Checksum != "" {
+		t.Fatalf("Status()=%#v; want applied migration without metadata", statuses)
+	}
+}
+
+func TestPgxStatusDoesNotWaitForRunningMigration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "status_running_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	ms := Migrations{{Version: 1, Name: "one", Path: "001-one.sql", SQL: "SELECT 1"}}
+
+	if err := New(ms, newPgxDB(newPgxPoolConn(conn), tableName)).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() first run: %v", err)
+	}
+
+	ms = append(ms, Migration{
+		Version: 2,
+		Name:    "two",
+		Path:    "002-two.sql",
+		SQL:     "SELECT 2",
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	migrator := New(ms, nil, WithCustomTable(tableName), WithHooks(Hooks{ //nolint:exhaustruct
+		BeforeEach: func(context.Context, pgx.Tx, Migration) error {
+			close(started)
+			<-release
+
+			return nil
+		},
+	}))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	migrated := make(chan error, 1)
+
+	go func() {
+		migrated <- migrator.Migrate(ctx)
+	}()
+
+	<-started
+
+	reader, err := pool.Acquire(ctx)
+	if err != nil {
+		close(release)
+		t.Fatalf("acquire reader connection: %v", err)
+	}
+	defer reader.Release()
+
+	statusCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	statuses, err := New(ms, newPgxDB(newPgxPoolConn(reader), tableName)).Status(statusCtx)
+
+	close(release)
+
+	if migrateErr := <-migrated; migrateErr != nil {
+		t.Fatalf("Migrate() second run: %v", migrateErr)
+	}
+
+	if err != nil {
+		t.Fatalf("Status() during migration: %v", err)
+	}
+
+	if len(statuses) != 2 || statuses[0].State != StateApplied || statuses[1].State != StatePending {
+		t.Fatalf("Status()=%#v; want first migration applied and second pending", statuses)
+	}
+}
+
+func TestPgxMigrateRunsNoTransactionMigrations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "no_tx_versions")
+	usersTable := testTableName(t, "no_tx_users")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, usersTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	migrator := New(Migrations{
+		{
+			Version: 1,
+			Path:    "001-users.sql",
+			SQL:     "CREATE TABLE " + usersTable + " (email text)",
+		},
+		{
+			Version:       2,
+			Path:          "002-index.sql",
+			SQL:           "CREATE INDEX CONCURRENTLY " + usersTable + "_email_idx ON " + usersTable + " (email)",
+			NoTransaction: true,
+		},
+	}, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	if !tableExists(ctx, t, pool, usersTable+"_email_idx") {
+		t.Fatal("index does not exist; want non-transactional migration applied")
+	}
+
+	var count int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM "+tableName+" WHERE NOT dirty").Scan(&count); err != nil {
+		t.Fatalf("count migration versions: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("clean migration versions=%d; want 2", count)
+	}
+
+	var locks int
+	if err := pool.QueryRow(ctx,
+		"SELECT count(*) FROM pg_locks WHERE locktype = 'advisory' AND pid = $1", conn.Conn().PgConn().PID(),
+	).Scan(&locks); err != nil {
+		t.Fatalf("count advisory locks: %v", err)
+	}
+	if locks != 0 {
+		t.Fatalf("advisory locks held after Migrate()=%d; want 0", locks)
+	}
+}
+
+func TestPgxMigrateIsAtomicWhenNoTransactionMigrationsAreApplied(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "no_tx_atomic_versions")
+	usersTable := testTableName(t, "no_tx_atomic_users")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, usersTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	db := newPgxDB(newPgxPoolConn(conn), tableName)
+	ms := Migrations{{
+		Version:       1,
+		Path:          "001-noop.sql",
+		SQL:           "SELECT 1",
+		NoTransaction: true,
+	}}
+
+	if err := New(ms, db).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	ms = append(ms, Migration{
+		Version: 2,
+		Path:    "002-users.sql",
+		SQL:     "CREATE TABLE " + usersTable + " (id integer)",
+	}, Migration{
+		Version: 3,
+		Path:    "003-broken.sql",
+		SQL:     "SELECT 1 / 0",
+	})
+
+	if err := New(ms, db).Migrate(ctx); err == nil {
+		t.Fatal("Migrate() error=<nil>; want migration error")
+	}
+
+	if tableExists(ctx, t, pool, usersTable) {
+		t.Fatal("users table exists; want pending migrations rolled back together")
+	}
+
+	var count int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM "+tableName).Scan(&count); err != nil {
+		t.Fatalf("count migration versions: %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("migration versions=%d; want 1", count)
+	}
+}
+
+func TestPgxMigrateRecordsFailedNoTransactionMigrationAsDirty(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "dirty_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	migrator := New(Migrations{{
+		Version:       1,
+		Path:          "001-broken.sql",
+		SQL:           "CREATE INDEX CONCURRENTLY broken_idx ON missing_table (id)",
+		NoTransaction: true,
+	}}, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.Migrate(ctx); err == nil {
+		t.Fatal("Migrate() error=<nil>; want migration error")
+	}
+
+	var dirty bool
+	if err := pool.QueryRow(ctx, "SELECT dirty FROM "+tableName+" WHERE version = 1").Scan(&dirty); err != nil {
+		t.Fatalf("read dirty flag: %v", err)
+	}
+	if !dirty {
+		t.Fatal("dirty=false; want failed non-transactional migration recorded as dirty")
+	}
+}
+
+func TestPgxMigrateRefusesDirtyVersionUntilForced(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "force_versions")
+	sideEffectTable := testTableName(t, "force_side_effect")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, sideEffectTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	ms := Migrations{
+		{
+			Version:       1,
+			Path:          "001-broken.sql",
+			SQL:           "CREATE INDEX CONCURRENTLY broken_idx ON missing_table (id)",
+			NoTransaction: true,
+		},
+		{
+			Version: 2,
+			Path:    "002-next.sql",
+			SQL:     "CREATE TABLE " + sideEffectTable + " (id integer)",
+		},
+	}
+	migrator := New(ms, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.Migrate(ctx); err == nil {
+		t.Fatal("Migrate() error=<nil>; want migration error")
+	}
+
+	err = migrator.Migrate(ctx)
+	if !errors.Is(err, ErrDirty) {
+		t.Fatalf("Migrate() error=%v; want dirty error", err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status(): %v", err)
+	}
+	if statuses[0].State != StateDirty {
+		t.Fatalf("Status()[0].State=%s; want %s", statuses[0].State, StateDirty)
+	}
+
+	if err := migrator.Force(ctx, 1); err != nil {
+		t.Fatalf("Force(1): %v", err)
+	}
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() after Force(): %v", err)
+	}
+
+	if !tableExists(ctx, t, pool, sideEffectTable) {
+		t.Fatalf("side effect table %s does not exist; want next migration applied", sideEffectTable)
+	}
+}
+
+func TestPgxForceForgetsDirtyVersionsAbove(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "force_below_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	migrator := New(Migrations{{
+		Version:       1,
+		Path:          "001-broken.sql",
+		SQL:           "CREATE INDEX CONCURRENTLY broken_idx ON missing_table (id)",
+		NoTransaction: true,
+	}}, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.Migrate(ctx); err == nil {
+		t.Fatal("Migrate() error=<nil>; want migration error")
+	}
+
+	if err := migrator.Force(ctx, 0); err != nil {
+		t.Fatalf("Force(0): %v", err)
+	}
+
+	var count int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM "+tableName).Scan(&count); err != nil {
+		t.Fatalf("count migration versions: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("migration versions=%d; want dirty version forgotten", count)
+	}
+}
+
+func TestPgxMigrateRunsGoMigrations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "go_versions")
+	usersTable := testTableName(t, "go_users")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, usersTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	ms, err := Migrations{{
+		Version: 1,
+		Path:    "001-users.sql",
+		SQL:     "CREATE TABLE " + usersTable + " (name text)",
+		DownSQL: "DROP TABLE " + usersTable,
+	}}.Register(2, "backfill", func(ctx context.Context, tx pgx.Tx) error {
+		for _, name := range []string{"alice", "bob"} {
+			if _, err := tx.Exec(ctx, "INSERT INTO "+usersTable+" (name) VALUES ($1)", name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM "+usersTable)
+
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Register(): %v", err)
+	}
+
+	migrator := New(ms, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	var count int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM "+usersTable).Scan(&count); err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("users=%d; want 2 from Go migration", count)
+	}
+
+	if err := migrator.Rollback(ctx, 1); err != nil {
+		t.Fatalf("Rollback(1): %v", err)
+	}
+
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM "+usersTable).Scan(&count); err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("users=%d; want 0 after Go down migration", count)
+	}
+}
+
+func TestPgxPlanListsPendingMigrationsWithoutApplyingThem(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "plan_versions")
+	sideEffectTable := testTableName(t, "plan_side_effect")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, sideEffectTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	db := newPgxDB(newPgxPoolConn(conn), tableName)
+	ms := Migrations{{
+		Version: 1,
+		Path:    "001-one.sql",
+		SQL:     "SELECT 1",
+	}}
+
+	if err := New(ms, db).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	ms = append(ms, Migration{
+		Version: 2,
+		Path:    "002-two.sql",
+		SQL:     "CREATE TABLE " + sideEffectTable + " (id integer)",
+	})
+
+	pending, err := New(ms, db).Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan(): %v", err)
+	}
+
+	if len(pending) != 1 || pending[0].Version != 2 || pending[0].SQL != ms[1].SQL {
+		t.Fatalf("Plan()=%#v; want migration 2 with its SQL", pending)
+	}
+
+	if tableExists(ctx, t, pool, sideEffectTable) {
+		t.Fatalf("side effect table %s exists; want Plan() not to apply migrations", sideEffectTable)
+	}
+}
+
+func TestPgxMigrateWithDryRunRollsBack(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "dry_run_versions")
+	sideEffectTable := testTableName(t, "dry_run_side_effect")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, sideEffectTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	ms := Migrations{{
+		Version: 1,
+		Path:    "001-one.sql",
+		SQL:     "CREATE TABLE " + sideEffectTable + " (id integer)",
+	}}
+	migrator := New(ms, nil, WithDryRun())
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() with dry run: %v", err)
+	}
+
+	if tableExists(ctx, t, pool, sideEffectTable) || tableExists(ctx, t, pool, tableName) {
+		t.Fatal("dry run left changes; want transaction rolled back")
+	}
+
+	ms[0].SQL = "CREATE TABLE"
+
+	if err := migrator.Migrate(ctx); err == nil {
+		t.Fatal("Migrate() with dry run error=<nil>; want migration error")
+	}
+
+	migrator = New(Migrations{{
+		Version:       1,
+		Path:          "001-index.sql",
+		SQL:           "CREATE INDEX CONCURRENTLY dry_run_idx ON " + sideEffectTable + " (id)",
+		NoTransaction: true,
+	}}, nil, WithDryRun())
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	err = migrator.Migrate(ctx)
+	if !errors.Is(err, ErrDryRunNoTransaction) {
+		t.Fatalf("Migrate() with dry run error=%v; want dry run no transaction error", err)
+	}
+}
+
+func TestPgxMigrateDetectsOutOfOrderMigrations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "out_of_order_versions")
+	sideEffectTable := testTableName(t, "out_of_order_side_effect")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, sideEffectTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	first := Migration{Version: 1, Path: "001-one.sql", SQL: "SELECT 1"}
+	merged := Migration{Version: 2, Path: "002-merged.sql", SQL: "CREATE TABLE " + sideEffectTable + " (id integer)"}
+	third := Migration{Version: 3, Path: "003-three.sql", SQL: "SELECT 3"}
+
+	if err := New(Migrations{first, third}, newPgxDB(newPgxPoolConn(conn), tableName)).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	ms := Migrations{first, merged, third}
+
+	err = New(ms, newPgxDB(newPgxPoolConn(conn), tableName)).Migrate(ctx)
+	if !errors.Is(err, ErrOutOfOrder) {
+		t.Fatalf("Migrate() error=%v; want out of order error", err)
+	}
+
+	if !strings.Contains(err.Error(), "version 2 from file 002-merged.sql") {
+		t.Fatalf("Migrate() error=%q; want out of order version and path", err)
+	}
+
+	migrator := New(ms, nil, WithAllowOutOfOrder())
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() with out of order allowed: %v", err)
+	}
+
+	if !tableExists(ctx, t, pool, sideEffectTable) {
+		t.Fatalf("side effect table %s does not exist; want out of order migration applied", sideEffectTable)
+	}
+}
+
+func TestPgxMigrateWithLoggerLogsLockAndTable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "logger_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	var logs bytes.Buffer
+
+	migrator := New(Migrations{{
+		Version: 1,
+		Path:    "001-one.sql",
+		SQL:     "SELECT 1",
+	}}, nil, WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))) //nolint:exhaustruct
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	for _, want := range []string{
+		`msg="migration lock acquired"`,
+		`msg="migrations table ready" table=` + tableName,
+		`msg="migration applied" version=1`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs=%s; want %s", logs.String(), want)
+		}
+	}
+}
+
+func TestPgxMigrateWithTracerProviderRecordsChildSpans(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "tracing_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	exporter := tracetest.NewInMemoryExporter()
+	migrator := New(Migrations{
+		{
+			Version: 1,
+			Path:    "001-one.sql",
+			SQL:     "SELECT 1",
+		},
+		{
+			Version: 2,
+			Path:    "002-broken.sql",
+			SQL:     "CREATE TABLE",
+		},
+	}, nil, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err == nil {
+		t.Fatal("Migrate() error=<nil>; want migration error")
+	}
+
+	spans := make(map[string][]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = append(spans[span.Name], span)
+	}
+
+	for name, count := range map[string]int{
+		"mig.Migrate":      1,
+		"mig.lock":         1,
+		"mig.last_version": 1,
+		"mig.migration":    2,
+	} {
+		if len(spans[name]) != count {
+			t.Fatalf("%s spans=%d; want %d", name, len(spans[name]), count)
+		}
+	}
+
+	root := spans["mig.Migrate"][0].SpanContext.SpanID()
+	for _, span := range spans["mig.migration"] {
+		if span.Parent.SpanID() != root {
+			t.Fatalf("migration span parent=%s; want %s", span.Parent.SpanID(), root)
+		}
+	}
+
+	failed := spans["mig.migration"][1]
+	if failed.Status.Code != codes.Error {
+		t.Fatalf("failed migration span status=%v; want error", failed.Status)
+	}
+
+	if !slices.Contains(failed.Attributes, attribute.String("db.response.status_code", "42601")) {
+		t.Fatalf("failed migration span attributes=%v; want PostgreSQL error code", failed.Attributes)
+	}
+}
+
+func TestPgxMigrateWithHooksRunsHooksInOrder(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "hook_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	var calls []string
+
+	migrator := New(Migrations{
+		{Version: 1, Path: "001-one.sql", SQL: "SELECT 1"},
+		{Version: 2, Path: "002-two.sql", SQL: "SELECT 2"},
+	}, nil, WithHooks(Hooks{
+		BeforeAll: func(context.Context, pgx.Tx) error {
+			calls = append(calls, "before all")
+			return nil
+		},
+		BeforeEach: func(_ context.Context, _ pgx.Tx, m Migration) error {
+			calls = append(calls, fmt.Sprintf("before %d", m.Version))
+			return nil
+		},
+		AfterEach: func(_ context.Context, _ pgx.Tx, m Migration) error {
+			calls = append(calls, fmt.Sprintf("after %d", m.Version))
+			return nil
+		},
+		AfterAll: func(context.Context, pgx.Tx) error {
+			calls = append(calls, "after all")
+			return nil
+		},
+		OnError: func(_ context.Context, m Migration, err error) {
+			t.Errorf("OnError(%d, %v) called", m.Version, err)
+		},
+	}))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	want := []string{"before all", "before 1", "after 1", "before 2", "after 2", "after all"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("calls=%v; want %v", calls, want)
+	}
+}
+
+func TestPgxMigrateWithHooksAbortsRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "hook_abort_versions")
+	sideEffectTable := testTableName(t, "hook_abort_side_effects")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, sideEffectTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	hookErr := errors.New("audit failed")
+
+	var failed []uint64
+
+	migrator := New(Migrations{
+		{Version: 1, Path: "001-side-effect.sql", SQL: "CREATE TABLE " + sideEffectTable + " (id integer)"},
+	}, nil, WithCustomTable(tableName), WithHooks(Hooks{ //nolint:exhaustruct
+		AfterEach: func(context.Context, pgx.Tx, Migration) error {
+			return hookErr
+		},
+		OnError: func(_ context.Context, m Migration, err error) {
+			if !errors.Is(err, hookErr) {
+				t.Errorf("OnError() error=%v; want hook error", err)
+			}
+
+			failed = append(failed, m.Version)
+		},
+	}))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); !errors.Is(err, hookErr) {
+		t.Fatalf("Migrate() error=%v; want hook error", err)
+	}
+
+	if !slices.Equal(failed, []uint64{1}) {
+		t.Fatalf("failed=%v; want [1]", failed)
+	}
+
+	if tableExists(ctx, t, pool, sideEffectTable) {
+		t.Fatalf("side effect table %s exists; want migration transaction rolled back", sideEffectTable)
+	}
+}
+
+func TestPgxMigrateWithLockTimeoutReportsLockHolder(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "lock_timeout_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	config, err := pgx.ParseConfig(testDSN())
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	config.RuntimeParams["application_name"] = "mig-lock-holder"
+
+	holder, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer holder.Close(ctx) //nolint:errcheck
+
+	if _, err := holder.Exec(ctx, "SELECT pg_advisory_lock($1)", int64(-7)); err != nil {
+		t.Fatalf("hold lock: %v", err)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	migrator := New(Migrations{{Version: 1, Path: "001-one.sql", SQL: "SELECT 1"}}, nil, //nolint:exhaustruct
+		WithCustomTable(tableName), WithLockKey(-7), WithLockTimeout(300*time.Millisecond))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	start := time.Now()
+
+	err = migrator.Migrate(ctx)
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Migrate() error=%v; want ErrLockTimeout", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Migrate() took %s; want it to give up after the lock timeout", elapsed)
+	}
+
+	want := fmt.Sprintf("held by pid %d, application %q", holder.PgConn().PID(), "mig-lock-holder")
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("Migrate() error=%q; want %s", err, want)
+	}
+}
+
+func TestPgxMigrateWithTableLockModeLocksMigrationsTable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "table_lock_versions")
+	lockCountTable := testTableName(t, "table_lock_counts")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, lockCountTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	migrator := New(Migrations{{ //nolint:exhaustruct
+		Version: 1,
+		Path:    "001-check-lock.sql",
+		SQL: fmt.Sprintf(`
+			CREATE TABLE %s AS
+			SELECT
+				count(*) FILTER (WHERE locktype = 'advisory') AS advisory,
+				count(*) FILTER (WHERE locktype = 'relation' AND relation = '%s'::regclass
+					AND mode = 'ExclusiveLock') AS exclusive
+			FROM pg_locks
+			WHERE pid = pg_backend_pid() AND granted`,
+			lockCountTable, tableName),
+	}}, nil, WithCustomTable(tableName), WithLockMode(LockTable))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	var advisory, exclusive int
+
+	if err := pool.QueryRow(ctx, "SELECT advisory, exclusive FROM "+lockCountTable).Scan(&advisory, &exclusive); err != nil {
+		t.Fatalf("query lock counts: %v", err)
+	}
+
+	if advisory != 0 || exclusive != 1 {
+		t.Fatalf("advisory locks=%d, exclusive table locks=%d; want 0 and 1", advisory, exclusive)
+	}
+
+	migrator = New(Migrations{
+		{Version: 1, Path: "001-check-lock.sql", SQL: migrator.ms[0].SQL},
+		{Version: 2, Path: "002-index.sql", SQL: "SELECT 1", NoTransaction: true},
+	}, nil, WithCustomTable(tableName), WithLockMode(LockTable))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); !errors.Is(err, ErrTableLockNoTransaction) {
+		t.Fatalf("Migrate() error=%v; want ErrTableLockNoTransaction", err)
+	}
+}
+
+func TestPgxMigrateWithTableLockModeHandlesConcurrentFirstRuns(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "table_lock_first_run_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	// The pool holds at least four connections.
+	const runs = 4
+
+	conns := make([]*pgxpool.Conn, runs)
+
+	for i := range conns {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatalf("acquire connection: %v", err)
+		}
+		defer conn.Release()
+
+		conns[i] = conn
+	}
+
+	start := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for _, conn := range conns {
+		wg.Go(func() {
+			migrator := New(Migrations{{ //nolint:exhaustruct
+				Version: 1,
+				Path:    "001-one.sql",
+				SQL:     "SELECT 1",
+			}}, nil, WithCustomTable(tableName), WithLockMode(LockTable))
+			migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+			<-start
+
+			if err := migrator.Migrate(ctx); err != nil {
+				t.Errorf("concurrent Migrate(): %v", err)
+			}
+		})
+	}
+
+	close(start)
+	wg.Wait()
+
+	var count int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM "+tableName).Scan(&count); err != nil {
+		t.Fatalf("count migration versions: %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("migration versions=%d; want 1", count)
+	}
+}
+
+func TestPgxMigrateWithTableLockModeReportsLockHolder(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "table_lock_timeout_versions")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	if _, err := pool.Exec(ctx, "CREATE TABLE "+tableName+" (version bigint PRIMARY KEY)"); err != nil {
+		t.Fatalf("create migration table %s: %v", tableName, err)
+	}
+
+	config, err := pgx.ParseConfig(testDSN())
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	config.RuntimeParams["application_name"] = "mig-table-lock-holder"
+
+	holder, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer holder.Close(ctx) //nolint:errcheck
+
+	tx, err := holder.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if _, err := tx.Exec(ctx, "LOCK TABLE "+tableName+" IN EXCLUSIVE MODE"); err != nil {
+		t.Fatalf("hold lock: %v", err)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	migrator := New(Migrations{{Version: 1, Path: "001-one.sql", SQL: "SELECT 1"}}, nil, //nolint:exhaustruct
+		WithCustomTable(tableName), WithLockMode(LockTable), WithLockTimeout(300*time.Millisecond))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	err = migrator.Migrate(ctx)
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Migrate() error=%v; want ErrLockTimeout", err)
+	}
+
+	want := fmt.Sprintf("held by pid %d, application %q", holder.PgConn().PID(), "mig-table-lock-holder")
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("Migrate() error=%q; want %s", err, want)
+	}
+}
+
+func TestPgxMigrateSetsMigrationTimeouts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "timeout_versions")
+	settingsTable := testTableName(t, "timeout_settings")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, settingsTable)
+	})
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	record := func(version int) string {
+		return fmt.Sprintf("INSERT INTO %s VALUES (%d, current_setting('lock_timeout'), current_setting('statement_timeout'))",
+			settingsTable, version)
+	}
+
+	migrator := New(Migrations{
+		{
+			Version: 1,
+			Path:    "001-settings.sql",
+			SQL:     fmt.Sprintf("CREATE TABLE %s (version int, lock_timeout text, statement_timeout text); %s", settingsTable, record(1)),
+		},
+		{
+			Version:          2,
+			Path:             "002-timeouts.sql",
+			SQL:              record(2),
+			LockTimeout:      5 * time.Second,
+			StatementTimeout: 10 * time.Minute,
+		},
+		{
+			Version: 3,
+			Path:    "003-defaults.sql",
+			SQL:     record(3),
+		},
+	}, nil, WithCustomTable(tableName), WithDefaultLockTimeout(2*time.Second))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	rows, err := pool.Query(ctx, "SELECT lock_timeout || ' ' || statement_timeout FROM "+settingsTable+" ORDER BY version")
+	if err != nil {
+		t.Fatalf("query settings: %v", err)
+	}
+
+	got, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatalf("collect settings: %v", err)
+	}
+
+	want := []string{"2s 0", "5s 10min", "2s 0"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("settings=%v; want %v", got, want)
+	}
+
+	var lockTimeout string
+	if err := conn.QueryRow(ctx, "SELECT current_setting('lock_timeout')").Scan(&lockTimeout); err != nil {
+		t.Fatalf("query lock timeout: %v", err)
+	}
+
+	if lockTimeout != "0" {
+		t.Fatalf("lock_timeout=%s after Migrate(); want 0", lockTimeout)
+	}
+}
+
+func TestPgxMigrateWithRetryRetriesFromSavepoint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "retry_versions")
+	firstTable := testTableName(t, "retry_first")
+	lockedTable := testTableName(t, "retry_locked")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, firstTable)
+		dropTable(ctx, t, pool, lockedTable)
+	})
+
+	if _, err := pool.Exec(ctx, "CREATE TABLE "+lockedTable+" (id integer)"); err != nil {
+		t.Fatalf("create locked table: %v", err)
+	}
+
+	holder, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer holder.Rollback(ctx) //nolint:errcheck
+
+	if _, err := holder.Exec(ctx, "LOCK TABLE "+lockedTable+" IN ACCESS SHARE MODE"); err != nil {
+		t.Fatalf("hold lock: %v", err)
+	}
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		holder.Rollback(ctx) //nolint:errcheck
+	}()
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	migrator := New(Migrations{
+		{Version: 1, Path: "001-first.sql", SQL: "CREATE TABLE " + firstTable + " (id integer)"},
+		{
+			Version:     2,
+			Path:        "002-locked.sql",
+			SQL:         "ALTER TABLE " + lockedTable + " ADD COLUMN name text",
+			LockTimeout: 100 * time.Millisecond,
+		},
+	}, nil, WithCustomTable(tableName), WithRetry(20, 50*time.Millisecond))
+	migrator.db = migrator.pgxDatabase(newPgxPoolConn(conn))
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	if !tableExists(ctx, t, pool, firstTable) {
+		t.Fatalf("table %s does not exist; want earlier migration kept", firstTable)
+	}
+}
+
+func TestPgxAdoptSeedsGooseHistory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "adopt_goose_versions")
+	historyTable := testTableName(t, "adopt_goose_db_version")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, historyTable)
+	})
+
+	if _, err := pool.Exec(ctx, `CREATE TABLE `+historyTable+` (id serial PRIMARY KEY, version_id bigint NOT NULL,
+		is_applied boolean NOT NULL, tstamp timestamp DEFAULT now());
+		INSERT INTO `+historyTable+` (version_id, is_applied) VALUES (0, true), (1, true), (2, true), (2, false), (3, true)`,
+	); err != nil {
+		t.Fatalf("create goose history: %v", err)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	ms := Migrations{
+		{Version: 1, Name: "one", Path: "00001_one.sql", SQL: "SELECT 1"},
+		{Version: 2, Name: "two", Path: "00002_two.sql", SQL: "SELECT 2"},
+		{Version: 3, Name: "three", Path: "00003_three.sql", SQL: "SELECT 3"},
+	}
+	migrator := New(ms, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.Adopt(ctx, DialectGoose, historyTable); err != nil {
+		t.Fatalf("Adopt(): %v", err)
+	}
+
+	// Adopting again leaves the seeded versions unchanged.
+	if err := migrator.Adopt(ctx, DialectGoose, historyTable); err != nil {
+		t.Fatalf("Adopt() again: %v", err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status(): %v", err)
+	}
+
+	var applied []uint64
+
+	for _, s := range statuses {
+		if s.Applied != nil {
+			applied = append(applied, s.Version)
+		}
+	}
+
+	// Version 2 was rolled back with goose, so it is left to be applied.
+	if !slices.Equal(applied, []uint64{1, 3}) {
+		t.Fatalf("applied versions=%v; want [1 3]", applied)
+	}
+}
+
+func TestPgxAdoptSeedsFlywayBaselineAndRefusesFailedMigrations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "adopt_flyway_versions")
+	historyTable := testTableName(t, "adopt_flyway_schema_history")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+		dropTable(ctx, t, pool, historyTable)
+	})
+
+	if _, err := pool.Exec(ctx, `CREATE TABLE `+historyTable+` (installed_rank integer PRIMARY KEY,
+		version varchar(50), type varchar(20) NOT NULL, success boolean NOT NULL);
+		INSERT INTO `+historyTable+` VALUES (1, '2', 'BASELINE', true), (2, '3', 'SQL', true),
+			(3, NULL, 'SQL', true)`,
+	); err != nil {
+		t.Fatalf("create flyway history: %v", err)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	ms := Migrations{
+		{Version: 1, Name: "one", Path: "V1__one.sql", SQL: "SELECT 1"},
+		{Version: 3, Name: "three", Path: "V3__three.sql", SQL: "SELECT 3"},
+		{Version: 4, Name: "four", Path: "V4__four.sql", SQL: "SELECT 4"},
+	}
+	migrator := New(ms, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.Adopt(ctx, DialectFlyway, historyTable); err != nil {
+		t.Fatalf("Adopt(): %v", err)
+	}
+
+	pending, err := migrator.Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan(): %v", err)
+	}
+
+	if len(pending) != 1 || pending[0].Version != 4 {
+		t.Fatalf("Plan()=%#v; want version 4 pending", pending)
+	}
+
+	if _, err := pool.Exec(ctx, "INSERT INTO "+historyTable+" VALUES (4, '4', 'SQL', false)"); err != nil {
+		t.Fatalf("record failed migration: %v", err)
+	}
+
+	if err := migrator.Adopt(ctx, DialectFlyway, historyTable); !errors.Is(err, ErrDirty) {
+		t.Fatalf("Adopt() error=%v; want dirty error", err)
+	}
+}
+
+func TestPgxAdoptUpgradesGolangMigrateTableInPlace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "adopt_golang_migrate")
+	pool := pgxPool(ctx, t)
+	t.Cleanup(func() {
+		dropTable(ctx, t, pool, tableName)
+	})
+
+	if _, err := pool.Exec(ctx, `CREATE TABLE `+tableName+` (version bigint NOT NULL PRIMARY KEY,
+		dirty boolean NOT NULL); INSERT INTO `+tableName+` VALUES (2, false)`); err != nil {
+		t.Fatalf("create golang-migrate history: %v", err)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	ms := Migrations{
+		{Version: 1, Name: "one", Path: "1_one.up.sql", SQL: "SELECT 1"},
+		{Version: 2, Name: "two", Path: "2_two.up.sql", SQL: "SELECT 2"},
+		{Version: 3, Name: "three", Path: "3_three.up.sql", SQL: "SELECT 3"},
+	}
+	migrator := New(ms, newPgxDB(newPgxPoolConn(conn), tableName))
+
+	if err := migrator.Adopt(ctx, DialectGolangMigrate, tableName); err != nil {
+		t.Fatalf("Adopt(): %v", err)
+	}
+
+	pending, err := migrator.Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan(): %v", err)
+	}
+
+	if len(pending) != 1 || pending[0].Version != 3 {
+		t.Fatalf("Plan()=%#v; want version 3 pending", pending)
+	}
+
+	var name string
+	if err := pool.QueryRow(ctx, "SELECT name FROM "+tableName+" WHERE version = 2").Scan(&name); err != nil {
+		t.Fatalf("query adopted version: %v", err)
+	}
+
+	if name != "two" {
+		t.Fatalf("adopted name=%q; want two", name)
+	}
+}
+
+func pgxPool(ctx context.Context, t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	cfg, err := pgxpool.ParseConfig(testDSN())
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("connect config: %v", err)
+	}
+
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+func testDSN() string {
+	if dsn := os.Getenv("MIG_TEST_DSN"); dsn != "" {
+		return dsn
+	}
+
+	return dsn
+}
+
+func testTableName(t *testing.T, prefix string) string {
+	t.Helper()
+
+	return fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+}
+
+func dropTable(ctx context.Context, t *testing.T, pool *pgxpool.Pool, tableName string) {
+	t.Helper()
+
+	if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS "+tableName); err != nil {
+		t.Fatalf("drop table %s: %v", tableName, err)
+	}
+}
+
+func tableExists(ctx context.Context, t *testing.T, pool *pgxpool.Pool, tableName string) bool {
+	t.Helper()
+
+	var exists bool
+	if err := pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", tableName).Scan(&exists); err != nil {
+		t.Fatalf("check table %s exists: %v", tableName, err)
+	}
+
+	return exists
+}
+
+type executorFake struct {
+	err error
+}
+
+func (e executorFake) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, e.err
+}
+
+func (executorFake) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected Query call")
+}
+
+func (executorFake) QueryRow(context.Context, string, ...any) pgx.Row {
+	return nil
+}
+
+// failingExecutor fails the first failures calls to Exec with err.
+type failingExecutor struct {
+	executorFake
+
+	failures int
+	calls    int
+	err      error
+}
+
+func (e *failingExecutor) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	e.calls++
+	if e.calls <= e.failures {
+		return pgconn.CommandTag{}, e.err
+	}
+
+	return pgconn.CommandTag{}, nil
+}
+
+// cancelAwareConn fails calls with the error of a done context, like
+// pgconn, and records the statements executed otherwise.
+type cancelAwareConn struct {
+	executorFake
+	executed []string
+}
+
+func (c *cancelAwareConn) Exec(ctx context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	if err := ctx.Err(); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	c.executed = append(c.executed, sql)
+
+	return pgconn.CommandTag{}, nil
+}
+
+func (*cancelAwareConn) Begin(context.Context) (pgx.Tx, error) {
+	return nil, errors.New("unexpected Begin call")
+}
+
+// QueryRow returns the timeouts of a session without any.
+func (*cancelAwareConn) QueryRow(context.Context, string, ...any) pgx.Row {
+	return timeoutsRow{}
+}
+
+type timeoutsRow struct{}
+
+func (timeoutsRow) Scan(dest ...any) error {
+	for _, d := range dest {
+		*d.(*string) = "0" //nolint:forcetypeassert
+	}
+
+	return nil
+}
+
+type metricsFake struct {
+	applied  []uint64
+	failures []string
+}
+
+func (f *metricsFake) MigrationApplied(m Migration, _ bool, _ time.Duration) {
+	f.applied = append(f.applied, m.Version)
+}
+
+func (f *metricsFake) MigrationFailed(_ Migration, _ bool, code string) {
+	f.failures = append(f.failures, code)
+}
+
+func (*metricsFake) LockAcquired(time.Duration) {}
+
+type lockIdentityConn struct {
+	database string
+	schema   string
+}
+
+func (conn lockIdentityConn) QueryRow(context.Context, string, ...any) pgx.Row {
+	return lockIdentityRow(conn)
+}
+
+func (lockIdentityConn) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("unexpected Exec call")
+}
+
+func (lockIdentityConn) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected Query call")
 }
 
 func (lockIdentityConn) Begin(context.Context) (pgx.Tx, error) {
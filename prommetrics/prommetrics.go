@@ -0,0 +1,94 @@
+// Package prommetrics records the outcome of migrations run by mig with
+// Prometheus collectors.
+package prommetrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.acim.net/mig"
+)
+
+const namespace = "mig"
+
+// Metrics implements mig.Metrics and prometheus.Collector. Register it with
+// a Prometheus registry and pass it to mig.WithMetrics.
+type Metrics struct {
+	applied  *prometheus.CounterVec
+	failures *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	lockWait prometheus.Histogram
+}
+
+var (
+	_ mig.Metrics          = (*Metrics)(nil)
+	_ prometheus.Collector = (*Metrics)(nil)
+)
+
+// New returns metrics with empty collectors.
+func New() *Metrics {
+	return &Metrics{
+		applied: prometheus.NewCounterVec(prometheus.CounterOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Name:      "migrations_applied_total",
+			Help:      "Number of migrations applied or reverted.",
+		}, []string{"direction"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Name:      "migration_failures_total",
+			Help:      "Number of failed migrations by SQLSTATE, empty for errors not returned by PostgreSQL.",
+		}, []string{"direction", "sqlstate"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Name:      "migration_duration_seconds",
+			Help:      "Time spent executing a migration.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10), //nolint:mnd
+		}, []string{"direction"}),
+		lockWait: prometheus.NewHistogram(prometheus.HistogramOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Name:      "lock_wait_seconds",
+			Help:      "Time spent waiting for the migration lock.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10), //nolint:mnd
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.applied.Describe(ch)
+	m.failures.Describe(ch)
+	m.duration.Describe(ch)
+	m.lockWait.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.applied.Collect(ch)
+	m.failures.Collect(ch)
+	m.duration.Collect(ch)
+	m.lockWait.Collect(ch)
+}
+
+// MigrationApplied implements mig.Metrics.
+func (m *Metrics) MigrationApplied(_ mig.Migration, down bool, duration time.Duration) {
+	m.applied.WithLabelValues(direction(down)).Inc()
+	m.duration.WithLabelValues(direction(down)).Observe(duration.Seconds())
+}
+
+// MigrationFailed implements mig.Metrics.
+func (m *Metrics) MigrationFailed(_ mig.Migration, down bool, code string) {
+	m.failures.WithLabelValues(direction(down), code).Inc()
+}
+
+// LockAcquired implements mig.Metrics.
+func (m *Metrics) LockAcquired(wait time.Duration) {
+	m.lockWait.Observe(wait.Seconds())
+}
+
+func direction(down bool) string {
+	if down {
+		return "down"
+	}
+
+	return "up"
+}
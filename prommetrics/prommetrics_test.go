@@ -0,0 +1,79 @@
+package prommetrics_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.acim.net/mig"
+	"go.acim.net/mig/prommetrics"
+)
+
+func TestMetricsCountsMigrations(t *testing.T) {
+	t.Parallel()
+
+	metrics := prommetrics.New()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(metrics)
+
+	m := mig.Migration{Version: 3, Name: "users", Path: "003-users.sql"} //nolint:exhaustruct
+
+	metrics.MigrationApplied(m, false, 20*time.Millisecond)
+	metrics.MigrationApplied(mig.Migration{Version: 4}, false, 30*time.Millisecond) //nolint:exhaustruct
+	metrics.MigrationApplied(m, true, 10*time.Millisecond)
+	metrics.MigrationFailed(m, false, "42601")
+	metrics.MigrationFailed(m, false, "42601")
+	metrics.MigrationFailed(m, true, "")
+
+	want := `
+# HELP mig_migrations_applied_total Number of migrations applied or reverted.
+# TYPE mig_migrations_applied_total counter
+mig_migrations_applied_total{direction="down"} 1
+mig_migrations_applied_total{direction="up"} 2
+# HELP mig_migration_failures_total Number of failed migrations by SQLSTATE, empty for errors not returned by PostgreSQL.
+# TYPE mig_migration_failures_total counter
+mig_migration_failures_total{direction="down",sqlstate=""} 1
+mig_migration_failures_total{direction="up",sqlstate="42601"} 2
+`
+
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"mig_migrations_applied_total", "mig_migration_failures_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.CollectAndCount(metrics, "mig_migration_duration_seconds"); n != 2 {
+		t.Fatalf("duration series=%d; want 2", n)
+	}
+}
+
+func TestMetricsObservesLockWait(t *testing.T) {
+	t.Parallel()
+
+	metrics := prommetrics.New()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(metrics)
+
+	metrics.LockAcquired(2 * time.Second)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather(): %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "mig_lock_wait_seconds" {
+			continue
+		}
+
+		h := family.GetMetric()[0].GetHistogram()
+		if h.GetSampleCount() != 1 || h.GetSampleSum() != 2 {
+			t.Fatalf("lock wait count=%d sum=%f; want 1 and 2", h.GetSampleCount(), h.GetSampleSum())
+		}
+
+		return
+	}
+
+	t.Fatal("mig_lock_wait_seconds not gathered")
+}
@@ -0,0 +1,237 @@
+package mig
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// sqlExecutor is implemented by *sql.Conn and *sql.Tx.
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqlQuerier adapts a database/sql executor to pgxExecutor, so that pgxDB
+// can run on connections of any PostgreSQL driver for database/sql.
+type sqlQuerier struct {
+	exec sqlExecutor
+}
+
+func (q sqlQuerier) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	if _, err := q.exec.ExecContext(ctx, query, args...); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	return pgconn.CommandTag{}, nil
+}
+
+func (q sqlQuerier) Query(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+	rows, err := q.exec.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlRows{rows: rows}, nil
+}
+
+func (q sqlQuerier) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return sqlRow{row: q.exec.QueryRowContext(ctx, query, args...)}
+}
+
+// sqlConn is a pgxConn on a connection reserved from a *sql.DB. A single
+// connection is needed for the session level migration lock.
+type sqlConn struct {
+	sqlQuerier
+
+	conn *sql.Conn
+}
+
+func newSQLConn(conn *sql.Conn) pgxConn {
+	return sqlConn{sqlQuerier: sqlQuerier{exec: conn}, conn: conn}
+}
+
+func (c sqlConn) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := c.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlTx{sqlQuerier: sqlQuerier{exec: tx}, tx: tx, savepoint: 0}, nil
+}
+
+// sqlTx implements pgx.Tx on a *sql.Tx, or on a savepoint in it when
+// savepoint is not zero. Migration functions and hooks receive it with the
+// database/sql adapter, so only Exec, Query, QueryRow and the transaction
+// control methods are supported.
+type sqlTx struct {
+	sqlQuerier
+
+	tx        *sql.Tx
+	savepoint int
+}
+
+func (t *sqlTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	savepoint := t.savepoint + 1
+
+	if _, err := t.tx.ExecContext(ctx, "SAVEPOINT "+savepointName(savepoint)); err != nil {
+		return nil, err
+	}
+
+	return &sqlTx{sqlQuerier: t.sqlQuerier, tx: t.tx, savepoint: savepoint}, nil
+}
+
+func (t *sqlTx) Commit(ctx context.Context) error {
+	if t.savepoint == 0 {
+		return t.tx.Commit()
+	}
+
+	_, err := t.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepointName(t.savepoint))
+
+	return err
+}
+
+func (t *sqlTx) Rollback(ctx context.Context) error {
+	if t.savepoint == 0 {
+		return t.tx.Rollback()
+	}
+
+	_, err := t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepointName(t.savepoint))
+
+	return err
+}
+
+func (*sqlTx) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	return 0, fmt.Errorf("copy from: %w", errors.ErrUnsupported)
+}
+
+func (*sqlTx) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	return sqlBatchResults{}
+}
+
+func (*sqlTx) LargeObjects() pgx.LargeObjects {
+	return pgx.LargeObjects{}
+}
+
+func (*sqlTx) Prepare(context.Context, string, string) (*pgconn.StatementDescription, error) {
+	return nil, fmt.Errorf("prepare: %w", errors.ErrUnsupported)
+}
+
+func (*sqlTx) Conn() *pgx.Conn {
+	return nil
+}
+
+func savepointName(savepoint int) string {
+	return "mig_sp_" + strconv.Itoa(savepoint)
+}
+
+// sqlBatchResults fails every batched query, as batches are not supported
+// with database/sql.
+type sqlBatchResults struct{}
+
+func (sqlBatchResults) Exec() (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, fmt.Errorf("send batch: %w", errors.ErrUnsupported)
+}
+
+func (sqlBatchResults) Query() (pgx.Rows, error) {
+	return nil, fmt.Errorf("send batch: %w", errors.ErrUnsupported)
+}
+
+func (sqlBatchResults) QueryRow() pgx.Row {
+	return sqlRow{row: nil}
+}
+
+func (sqlBatchResults) Close() error {
+	return nil
+}
+
+type sqlRow struct {
+	row *sql.Row
+}
+
+func (r sqlRow) Scan(dest ...any) error {
+	if r.row == nil {
+		return fmt.Errorf("send batch: %w", errors.ErrUnsupported)
+	}
+
+	err := r.row.Scan(discardNil(dest)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return pgx.ErrNoRows
+	}
+
+	return err
+}
+
+type sqlRows struct {
+	rows *sql.Rows
+}
+
+func (r *sqlRows) Close() {
+	_ = r.rows.Close()
+}
+
+func (r *sqlRows) Err() error {
+	return r.rows.Err()
+}
+
+func (*sqlRows) CommandTag() pgconn.CommandTag {
+	return pgconn.CommandTag{}
+}
+
+func (*sqlRows) FieldDescriptions() []pgconn.FieldDescription {
+	return nil
+}
+
+func (r *sqlRows) Next() bool {
+	return r.rows.Next()
+}
+
+func (r *sqlRows) Scan(dest ...any) error {
+	return r.rows.Scan(discardNil(dest)...)
+}
+
+func (r *sqlRows) Values() ([]any, error) {
+	columns, err := r.rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	if err := r.rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (*sqlRows) RawValues() [][]byte {
+	return nil
+}
+
+func (*sqlRows) Conn() *pgx.Conn {
+	return nil
+}
+
+// discardNil replaces nil destinations, which pgx skips, with values
+// database/sql can scan into.
+func discardNil(dest []any) []any {
+	for i, d := range dest {
+		if d == nil {
+			dest[i] = new(any)
+		}
+	}
+
+	return dest
+}
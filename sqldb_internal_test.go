@@ -0,0 +1,217 @@
+package mig
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+var (
+	_ pgxConn  = sqlConn{} //nolint:exhaustruct
+	_ pgx.Tx   = (*sqlTx)(nil)
+	_ pgx.Row  = sqlRow{} //nolint:exhaustruct
+	_ pgx.Rows = (*sqlRows)(nil)
+)
+
+func TestFromSQLDBReturnsInvalidTableNameError(t *testing.T) {
+	t.Parallel()
+
+	migrator, cleanup, err := FromSQLDB(nil, nil, WithCustomTable("bad name"))
+	if !errors.Is(err, ErrInvalidTableName) {
+		t.Fatalf("FromSQLDB() error=%v; want invalid table name error", err)
+	}
+
+	if migrator != nil || cleanup != nil {
+		t.Fatal("FromSQLDB() returned migrator or cleanup with error")
+	}
+}
+
+func TestSQLDBMigrateRollbackAndStatus(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "sql_versions")
+	usersTable := testTableName(t, "sql_users")
+	db := sqlDB(t)
+	t.Cleanup(func() {
+		dropSQLTable(ctx, t, db, tableName)
+		dropSQLTable(ctx, t, db, usersTable)
+	})
+
+	ms := Migrations{
+		{
+			Version: 1,
+			Name:    "users",
+			Path:    "001-users.sql",
+			SQL:     "CREATE TABLE " + usersTable + " (id integer)",
+			DownSQL: "DROP TABLE " + usersTable,
+		},
+	}
+
+	ms, err := ms.Register(2, "seed", func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO "+usersTable+" VALUES ($1)", 1)
+
+		return err
+	}, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM "+usersTable)
+
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Register(): %v", err)
+	}
+
+	migrator, release, err := FromSQLDB(ms, db, WithCustomTable(tableName), WithAppIdentity("sql-test"))
+	if err != nil {
+		t.Fatalf("FromSQLDB(): %v", err)
+	}
+	defer release()
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	var users int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM "+usersTable).Scan(&users); err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+
+	if users != 1 {
+		t.Fatalf("users=%d; want 1", users)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status(): %v", err)
+	}
+
+	for _, s := range statuses {
+		if s.State != StateApplied || s.Applied == nil || s.Applied.AppliedAt.IsZero() || s.Applied.AppliedBy == "" {
+			t.Fatalf("Status()=%#v; want applied migration with metadata", s)
+		}
+	}
+
+	if err := migrator.Rollback(ctx, 2); err != nil {
+		t.Fatalf("Rollback(): %v", err)
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", usersTable).Scan(&exists); err != nil {
+		t.Fatalf("query table: %v", err)
+	}
+
+	if exists {
+		t.Fatalf("table %s exists after Rollback(); want dropped", usersTable)
+	}
+}
+
+func TestSQLDBMigrateRollsBackFailedRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "sql_failed_versions")
+	sideEffectTable := testTableName(t, "sql_failed_side_effects")
+	db := sqlDB(t)
+	t.Cleanup(func() {
+		dropSQLTable(ctx, t, db, tableName)
+		dropSQLTable(ctx, t, db, sideEffectTable)
+	})
+
+	migrator, release, err := FromSQLDB(Migrations{
+		{Version: 1, Path: "001-side-effect.sql", SQL: "CREATE TABLE " + sideEffectTable + " (id integer)"},
+		{Version: 2, Path: "002-broken.sql", SQL: "CREATE TABLE"},
+	}, db, WithCustomTable(tableName))
+	if err != nil {
+		t.Fatalf("FromSQLDB(): %v", err)
+	}
+	defer release()
+
+	err = migrator.Migrate(ctx)
+	if pgErrorCode(err) != "42601" {
+		t.Fatalf("Migrate() error=%v; want syntax error", err)
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", sideEffectTable).Scan(&exists); err != nil {
+		t.Fatalf("query table: %v", err)
+	}
+
+	if exists {
+		t.Fatalf("table %s exists; want migration transaction rolled back", sideEffectTable)
+	}
+}
+
+func TestSQLDBMigrateRunsNoTransactionMigrations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	ctx := context.Background()
+	tableName := testTableName(t, "sql_no_tx_versions")
+	usersTable := testTableName(t, "sql_no_tx_users")
+	db := sqlDB(t)
+	t.Cleanup(func() {
+		dropSQLTable(ctx, t, db, tableName)
+		dropSQLTable(ctx, t, db, usersTable)
+	})
+
+	migrator, release, err := FromSQLDB(Migrations{
+		{Version: 1, Path: "001-users.sql", SQL: "CREATE TABLE " + usersTable + " (id integer)"},
+		{
+			Version:       2,
+			Path:          "002-index.sql",
+			SQL:           "CREATE INDEX CONCURRENTLY " + usersTable + "_id_idx ON " + usersTable + " (id)",
+			NoTransaction: true,
+		},
+	}, db, WithCustomTable(tableName))
+	if err != nil {
+		t.Fatalf("FromSQLDB(): %v", err)
+	}
+	defer release()
+
+	if err := migrator.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	var version uint64
+	if err := db.QueryRowContext(ctx, "SELECT max(version) FROM "+tableName).Scan(&version); err != nil {
+		t.Fatalf("query version: %v", err)
+	}
+
+	if version != 2 {
+		t.Fatalf("version=%d; want 2", version)
+	}
+}
+
+func sqlDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("pgx", testDSN())
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("close database: %v", err)
+		}
+	})
+
+	return db
+}
+
+func dropSQLTable(ctx context.Context, t *testing.T, db *sql.DB, tableName string) {
+	t.Helper()
+
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+tableName); err != nil {
+		t.Fatalf("drop table %s: %v", tableName, err)
+	}
+}
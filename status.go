@@ -0,0 +1,124 @@
+package mig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MigrationState is the state of a migration as seen by Mig.Status.
+type MigrationState string
+
+const (
+	StateApplied          MigrationState = "applied"
+	StatePending          MigrationState = "pending"
+	StateMissing          MigrationState = "missing-on-disk"
+	StateChecksumMismatch MigrationState = "checksum-mismatch"
+	StateDirty            MigrationState = "dirty"
+)
+
+// StatusReader is implemented by databases able to list the migrations
+// recorded in the migrations table.
+type StatusReader interface {
+	AppliedMigrations(ctx context.Context) ([]AppliedMigration, error)
+}
+
+// AppliedMigration is a migration recorded in the migrations table. Fields
+// other than Version are empty for migrations applied by older releases.
+type AppliedMigration struct {
+	Version       uint64
+	Name          string
+	Path          string
+	AppliedAt     time.Time
+	ExecutionTime time.Duration
+	AppliedBy     string
+	Checksum      string
+	Dirty         bool
+}
+
+// MigrationStatus is a migration with its state and, unless pending, the
+// metadata stored when it was applied. Only Version, Name and Path of the
+// Migration are set for migrations missing on disk.
+type MigrationStatus struct {
+	Migration
+
+	State   MigrationState
+	Applied *AppliedMigration
+}
+
+// Status returns the state of all known and applied migrations ordered by
+// version.
+func (d *Mig) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if err := d.ms.Validate(); err != nil {
+		return nil, err
+	}
+
+	db, ok := d.db.(StatusReader)
+	if !ok {
+		return nil, fmt.Errorf("status: %w", errors.ErrUnsupported)
+	}
+
+	applied, err := db.AppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("applied migrations: %w", err)
+	}
+
+	return migrationStatuses(d.ms, applied), nil
+}
+
+func migrationStatuses(ms Migrations, applied []AppliedMigration) []MigrationStatus {
+	byVersion := make(map[uint64]*AppliedMigration, len(applied))
+
+	for i := range applied {
+		byVersion[applied[i].Version] = &applied[i]
+	}
+
+	statuses := make([]MigrationStatus, 0, len(ms)+len(applied))
+
+	for _, m := range ms {
+		a, ok := byVersion[m.Version]
+		if !ok {
+			statuses = append(statuses, MigrationStatus{Migration: m, State: StatePending, Applied: nil})
+
+			continue
+		}
+
+		state := StateApplied
+
+		switch {
+		case a.Dirty:
+			state = StateDirty
+		case a.Checksum != "" && a.Checksum != m.Checksum():
+			state = StateChecksumMismatch
+		}
+
+		statuses = append(statuses, MigrationStatus{Migration: m, State: state, Applied: a})
+
+		delete(byVersion, m.Version)
+	}
+
+	for _, a := range byVersion {
+		state := StateMissing
+		if a.Dirty {
+			state = StateDirty
+		}
+
+		statuses = append(statuses, MigrationStatus{
+			Migration: Migration{Version: a.Version, Name: a.Name, Path: a.Path}, //nolint:exhaustruct
+			State:     state,
+			Applied:   a,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses
+}
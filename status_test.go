@@ -0,0 +1,115 @@
+package mig_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.acim.net/mig"
+)
+
+type statusFake struct {
+	dbFake
+
+	applied []mig.AppliedMigration
+	err     error
+}
+
+func (db *statusFake) AppliedMigrations(context.Context) ([]mig.AppliedMigration, error) {
+	return db.applied, db.err
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	ms := mig.Migrations{
+		{Version: 1, Name: "one", Path: "001-one.sql", SQL: "SELECT 1"},   //nolint:exhaustruct
+		{Version: 2, Name: "two", Path: "002-two.sql", SQL: "SELECT 2"},   //nolint:exhaustruct
+		{Version: 4, Name: "four", Path: "004-four.sql", SQL: "SELECT 4"}, //nolint:exhaustruct
+	}
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	db := &statusFake{applied: []mig.AppliedMigration{ //nolint:exhaustruct
+		{Version: 1, Path: "001-one.sql", AppliedAt: appliedAt, Checksum: ms[0].Checksum()}, //nolint:exhaustruct
+		{Version: 2, Path: "002-two.sql", AppliedAt: appliedAt, Checksum: "edited"},         //nolint:exhaustruct
+		{Version: 3, Name: "three", Path: "003-three.sql", AppliedAt: appliedAt},            //nolint:exhaustruct
+	}}
+
+	got, err := mig.New(ms, db).Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status(): %v", err)
+	}
+
+	want := []struct {
+		version uint64
+		path    string
+		state   mig.MigrationState
+		applied bool
+	}{
+		{version: 1, path: "001-one.sql", state: mig.StateApplied, applied: true},
+		{version: 2, path: "002-two.sql", state: mig.StateChecksumMismatch, applied: true},
+		{version: 3, path: "003-three.sql", state: mig.StateMissing, applied: true},
+		{version: 4, path: "004-four.sql", state: mig.StatePending, applied: false},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("len(Status())=%d; want %d", len(got), len(want))
+	}
+
+	for i, w := range want {
+		if got[i].Version != w.version || got[i].Path != w.path || got[i].State != w.state {
+			t.Errorf("Status()[%d]=%d %s %s; want %d %s %s",
+				i, got[i].Version, got[i].Path, got[i].State, w.version, w.path, w.state)
+		}
+
+		if (got[i].Applied != nil) != w.applied {
+			t.Errorf("Status()[%d].Applied=%v; want applied %t", i, got[i].Applied, w.applied)
+		}
+
+		if got[i].Applied != nil && !got[i].Applied.AppliedAt.Equal(appliedAt) {
+			t.Errorf("Status()[%d].Applied.AppliedAt=%v; want %v", i, got[i].Applied.AppliedAt, appliedAt)
+		}
+	}
+}
+
+func TestStatusReportsDirtyMigrations(t *testing.T) {
+	t.Parallel()
+
+	ms := mig.Migrations{{Version: 1, Path: "001-index.sql", SQL: "SELECT 1"}} //nolint:exhaustruct
+	db := &statusFake{applied: []mig.AppliedMigration{                         //nolint:exhaustruct
+		{Version: 1, Path: "001-index.sql", Dirty: true},   //nolint:exhaustruct
+		{Version: 2, Path: "002-removed.sql", Dirty: true}, //nolint:exhaustruct
+	}}
+
+	got, err := mig.New(ms, db).Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status(): %v", err)
+	}
+
+	for i, s := range got {
+		if s.State != mig.StateDirty {
+			t.Errorf("Status()[%d].State=%s; want %s", i, s.State, mig.StateDirty)
+		}
+	}
+}
+
+func TestStatusWrapsDatabaseError(t *testing.T) {
+	t.Parallel()
+
+	appliedErr := errors.New("query failed")
+	db := &statusFake{err: appliedErr} //nolint:exhaustruct
+
+	_, err := mig.New(mig.Migrations{}, db).Status(context.Background())
+	if !errors.Is(err, appliedErr) {
+		t.Fatalf("Status() error=%v; want database error", err)
+	}
+}
+
+func TestStatusReturnsUnsupportedError(t *testing.T) {
+	t.Parallel()
+
+	_, err := mig.New(mig.Migrations{}, &dbFake{}).Status(context.Background()) //nolint:exhaustruct
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Status() error=%v; want unsupported error", err)
+	}
+}
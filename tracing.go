@@ -0,0 +1,37 @@
+package mig
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "go.acim.net/mig"
+
+func noopTracer() trace.Tracer {
+	return noop.NewTracerProvider().Tracer(tracerName)
+}
+
+func migrationAttributes(m Migration) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.Int64("mig.version", int64(m.Version)), //nolint:gosec // versions are PostgreSQL bigint values
+		attribute.String("mig.name", m.Name),
+		attribute.String("mig.path", m.Path),
+	)
+}
+
+// endSpan ends span, recording err and its PostgreSQL error code when err is
+// not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		if code := pgErrorCode(err); code != "" {
+			span.SetAttributes(attribute.String("db.response.status_code", code))
+		}
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,61 @@
+package mig_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.acim.net/mig"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMigrateWithTracerProviderRecordsRootSpan(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	m := mig.New(mig.Migrations{}, &dbFake{}, mig.WithTracerProvider(tp)) //nolint:exhaustruct
+
+	if err := m.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate(): %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "mig.Migrate" {
+		t.Fatalf("spans=%v; want one mig.Migrate span", spans)
+	}
+
+	if spans[0].Status.Code == codes.Error {
+		t.Fatalf("span status=%v; want no error", spans[0].Status)
+	}
+}
+
+func TestMigrateWithTracerProviderRecordsError(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	lockErr := errors.New("lock failed")
+
+	m := mig.New(mig.Migrations{}, &dbFake{lockErr: lockErr}, mig.WithTracerProvider(tp)) //nolint:exhaustruct
+
+	if err := m.Migrate(context.Background()); !errors.Is(err, lockErr) {
+		t.Fatalf("Migrate() error=%v; want lock error", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("len(spans)=%d; want 1", len(spans))
+	}
+
+	if spans[0].Status.Code != codes.Error {
+		t.Fatalf("span status=%v; want error", spans[0].Status)
+	}
+
+	if len(spans[0].Events) == 0 || spans[0].Events[0].Name != "exception" {
+		t.Fatalf("span events=%v; want recorded error", spans[0].Events)
+	}
+}